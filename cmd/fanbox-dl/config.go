@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var configFlag = &cli.StringFlag{
+	Name:  "config",
+	Value: "",
+	Usage: "Path to the YAML config file. By default, fanbox-dl/config.yaml in the user config directory (e.g. ~/.config) is used if it exists.",
+}
+
+// config is the content of the config file.
+// Keys of the top level are flag names, and flags set by the command line or environment variables take precedence.
+//
+//	save-dir: /archive/fanbox
+//	supporting: true
+//	creators:
+//	  creator1:
+//	    dir-by-post: true
+//	  creator2:
+//	    save-dir: /archive/creator2
+//	    skip-files: true
+type config struct {
+	Flags map[string]any `yaml:",inline"`
+	// Creators overrides flags of the creators, the keys are in the same forms as --creator.
+	Creators map[string]map[string]any `yaml:"creators"`
+}
+
+// creatorFlags are the flags which can be overridden for each creator.
+var creatorFlags = []cli.Flag{
+	saveDirFlag,
+	storageFlag,
+	dirByPostFlag,
+	dirByPlanFlag,
+	pathTemplateFlag,
+	postPathTemplateFlag,
+	originalFileNamesFlag,
+	removeUnprintableCharsFlag,
+	allFlag,
+	skipFiles,
+	skipImages,
+	skipPostMetadataFlag,
+	renderPostsFlag,
+	downloadEmbedsFlag,
+	ytDlpFlag,
+	dryRunFlag,
+	skipOnErrorFlag,
+	concurrencyFlag,
+	sinceFlag,
+	untilFlag,
+	minFeeFlag,
+	maxFeeFlag,
+	titleFlag,
+	excludeTitleFlag,
+	tagFlag,
+	excludeTagFlag,
+	postIDFlag,
+}
+
+// readConfig reads the config file.
+// It returns an empty config if --config is not set and the default config file doesn't exist.
+func readConfig(c *cli.Context) (*config, error) {
+	name := c.String(configFlag.Name)
+	if name == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return &config{}, nil
+		}
+		name = filepath.Join(dir, "fanbox-dl", "config.yaml")
+		if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+			return &config{}, nil
+		}
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	cfg := &config{}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("parse config file (%s): %w", name, err)
+	}
+
+	allFlags := make(map[string]cli.Flag)
+	collectFlags(allFlags, c.App.Flags, c.App.Commands)
+	for k, v := range cfg.Flags {
+		if err := validateConfigValue(allFlags, k, v); err != nil {
+			return nil, fmt.Errorf("config file (%s): %w", name, err)
+		}
+	}
+
+	overridable := make(map[string]cli.Flag)
+	collectFlags(overridable, creatorFlags, nil)
+	for id, flags := range cfg.Creators {
+		if _, err := fanbox.ParseCreatorInput(id); err != nil {
+			return nil, fmt.Errorf("config file (%s): %w", name, err)
+		}
+		for k, v := range flags {
+			if err := validateConfigValue(overridable, k, v); err != nil {
+				return nil, fmt.Errorf("config file (%s): creator %q: %w", name, id, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// applyConfig reads the config file, and sets flags of the command which are not set yet.
+func applyConfig(c *cli.Context) (*config, error) {
+	cfg, err := readConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]cli.Flag)
+	collectFlags(flags, c.Command.Flags, nil)
+	for k, v := range cfg.Flags {
+		if _, ok := flags[k]; !ok || c.IsSet(k) {
+			continue
+		}
+		if err := c.Set(k, configValueString(v)); err != nil {
+			return nil, fmt.Errorf("set %q from config file: %w", k, err)
+		}
+	}
+	return cfg, nil
+}
+
+// creatorOverrides returns the creators section of the config keyed by creator IDs,
+// keys such as "@creator", pixiv user IDs and URLs are resolved in the same way as --creator.
+func creatorOverrides(ctx context.Context, lister *fanbox.CreatorIDLister, cfg *config) (map[string]map[string]any, error) {
+	res := make(map[string]map[string]any, len(cfg.Creators))
+	for key, overrides := range cfg.Creators {
+		ids, err := lister.Resolve(ctx, []string{key})
+		if err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+		if _, ok := res[ids[0]]; ok {
+			return nil, fmt.Errorf("config file: creator %q is configured more than once", ids[0])
+		}
+		res[ids[0]] = overrides
+	}
+	return res, nil
+}
+
+func collectFlags(dst map[string]cli.Flag, flags []cli.Flag, commands []*cli.Command) {
+	for _, f := range flags {
+		for _, name := range f.Names() {
+			dst[name] = f
+		}
+	}
+	for _, cmd := range commands {
+		collectFlags(dst, cmd.Flags, cmd.Subcommands)
+	}
+}
+
+func validateConfigValue(flags map[string]cli.Flag, name string, v any) error {
+	f, ok := flags[name]
+	if !ok || name == configFlag.Name {
+		return fmt.Errorf("unknown option %q", name)
+	}
+
+	switch f.(type) {
+	case *cli.BoolFlag:
+		ok = isConfigValue[bool](v)
+	case *cli.IntFlag:
+		ok = isConfigValue[int](v)
+	case *cli.Float64Flag:
+		ok = isConfigValue[float64](v) || isConfigValue[int](v)
+	case *cli.StringFlag:
+		// comma separated values, such as creator IDs, can be written as a list
+		ok = isConfigValue[string](v) || isConfigValue[int](v)
+		if list, isList := v.([]any); isList {
+			ok = true
+			for _, item := range list {
+				ok = ok && (isConfigValue[string](item) || isConfigValue[int](item))
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value of %q: %v", name, v)
+	}
+	return nil
+}
+
+func isConfigValue[T any](v any) bool {
+	_, ok := v.(T)
+	return ok
+}
+
+func configValueString(v any) string {
+	if list, ok := v.([]any); ok {
+		s := make([]string, 0, len(list))
+		for _, item := range list {
+			s = append(s, fmt.Sprint(item))
+		}
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// flagSource is the source of flag values, such as *cli.Context.
+type flagSource interface {
+	Bool(name string) bool
+	String(name string) string
+	Int(name string) int
+}
+
+// creatorFlagSource returns the flag values overridden by the creators section of the config file.
+type creatorFlagSource struct {
+	*cli.Context
+	overrides map[string]any
+}
+
+func (s creatorFlagSource) Bool(name string) bool {
+	if v, ok := s.overrides[name].(bool); ok {
+		return v
+	}
+	return s.Context.Bool(name)
+}
+
+func (s creatorFlagSource) String(name string) string {
+	if v, ok := s.overrides[name]; ok {
+		return configValueString(v)
+	}
+	return s.Context.String(name)
+}
+
+func (s creatorFlagSource) Int(name string) int {
+	if v, ok := s.overrides[name].(int); ok {
+		return v
+	}
+	return s.Context.Int(name)
+}
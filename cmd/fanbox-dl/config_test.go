@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// runWithConfig runs the app with the config file and the arguments, and calls fn with the applied context.
+func runWithConfig(t *testing.T, content string, args []string, fn func(c *cli.Context, cfg *config)) {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(name, []byte(content), 0644))
+
+	// urfave/cli stores values from environment variables into flags, so each run uses copies of them
+	flags := make([]cli.Flag, 0, len(downloadFlags))
+	for _, f := range downloadFlags {
+		v := reflect.New(reflect.TypeOf(f).Elem())
+		v.Elem().Set(reflect.ValueOf(f).Elem())
+		flags = append(flags, v.Interface().(cli.Flag))
+	}
+
+	testApp := &cli.App{
+		Name:  "fanbox-dl",
+		Flags: flags,
+		Action: func(c *cli.Context) error {
+			cfg, err := applyConfig(c)
+			if err != nil {
+				return err
+			}
+			fn(c, cfg)
+			return nil
+		},
+	}
+	require.NoError(t, testApp.Run(append([]string{"fanbox-dl", "--config", name}, args...)))
+}
+
+// unsetSessionEnv unsets environment variables of sessid during the test.
+func unsetSessionEnv(t *testing.T) {
+	t.Helper()
+	for _, k := range sessIDFlag.EnvVars {
+		// Setenv restores the value after the test
+		t.Setenv(k, "")
+		require.NoError(t, os.Unsetenv(k))
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		env     map[string]string
+		check   func(t *testing.T, c *cli.Context)
+	}{
+		{
+			name:    "config values",
+			content: "save-dir: /archive\ndir-by-post: true\nconcurrency: 3\ncreator: [creator1, creator2]\n",
+			check: func(t *testing.T, c *cli.Context) {
+				assert.Equal(t, "/archive", c.String(saveDirFlag.Name))
+				assert.True(t, c.Bool(dirByPostFlag.Name))
+				assert.Equal(t, 3, c.Int(concurrencyFlag.Name))
+				assert.Equal(t, "creator1,creator2", c.String(creatorFlag.Name))
+			},
+		},
+		{
+			name:    "command line takes precedence",
+			content: "save-dir: /archive\nconcurrency: 3\n",
+			args:    []string{"--save-dir", "/cli"},
+			check: func(t *testing.T, c *cli.Context) {
+				assert.Equal(t, "/cli", c.String(saveDirFlag.Name))
+				assert.Equal(t, 3, c.Int(concurrencyFlag.Name))
+			},
+		},
+		{
+			name:    "environment variable takes precedence",
+			content: "sessid: config\n",
+			env:     map[string]string{"FANBOXSESSID": "env"},
+			check: func(t *testing.T, c *cli.Context) {
+				assert.Equal(t, "env", c.String(sessIDFlag.Name))
+			},
+		},
+		{
+			name:    "config is used without environment variables",
+			content: "sessid: config\n",
+			check: func(t *testing.T, c *cli.Context) {
+				assert.Equal(t, "config", c.String(sessIDFlag.Name))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetSessionEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			called := false
+			runWithConfig(t, tt.content, tt.args, func(c *cli.Context, _ *config) {
+				called = true
+				tt.check(t, c)
+			})
+			assert.True(t, called)
+		})
+	}
+}
+
+func TestValidateConfigValue(t *testing.T) {
+	flags := make(map[string]cli.Flag)
+	collectFlags(flags, downloadFlags, nil)
+
+	tests := []struct {
+		name    string
+		value   any
+		wantErr bool
+	}{
+		{name: "dir-by-post", value: true},
+		{name: "dir-by-post", value: "true", wantErr: true},
+		{name: "concurrency", value: 2},
+		{name: "concurrency", value: "2", wantErr: true},
+		{name: "api-rps", value: 1.5},
+		{name: "api-rps", value: 2},
+		{name: "save-dir", value: "/archive"},
+		{name: "creator", value: 12345},
+		{name: "creator", value: []any{"creator1", 12345}},
+		{name: "creator", value: []any{"creator1", true}, wantErr: true},
+		{name: "creator", value: map[string]any{"a": 1}, wantErr: true},
+		{name: "config", value: "other.yaml", wantErr: true},
+		{name: "unknown", value: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := validateConfigValue(flags, tt.name, tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "%s: %v", tt.name, tt.value)
+		} else {
+			assert.NoError(t, err, "%s: %v", tt.name, tt.value)
+		}
+	}
+}
+
+func TestCreatorFlagSource(t *testing.T) {
+	unsetSessionEnv(t)
+	content := `save-dir: /archive
+concurrency: 3
+creators:
+  creator1:
+    save-dir: /creator1
+    dir-by-post: true
+    concurrency: 1
+    tag: [a, b]
+`
+	runWithConfig(t, content, nil, func(c *cli.Context, cfg *config) {
+		tests := []struct {
+			creator string
+			check   func(t *testing.T, s flagSource)
+		}{
+			{
+				creator: "creator1",
+				check: func(t *testing.T, s flagSource) {
+					assert.Equal(t, "/creator1", s.String(saveDirFlag.Name))
+					assert.True(t, s.Bool(dirByPostFlag.Name))
+					assert.Equal(t, 1, s.Int(concurrencyFlag.Name))
+					assert.Equal(t, "a,b", s.String(tagFlag.Name))
+				},
+			},
+			{
+				creator: "creator2",
+				check: func(t *testing.T, s flagSource) {
+					assert.Equal(t, "/archive", s.String(saveDirFlag.Name))
+					assert.False(t, s.Bool(dirByPostFlag.Name))
+					assert.Equal(t, 3, s.Int(concurrencyFlag.Name))
+					assert.Equal(t, "", s.String(tagFlag.Name))
+				},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.creator, func(t *testing.T) {
+				tt.check(t, creatorFlagSource{Context: c, overrides: cfg.Creators[tt.creator]})
+			})
+		}
+	})
+}
+
+func TestCreatorOverrides(t *testing.T) {
+	lister := &fanbox.CreatorIDLister{}
+	tests := []struct {
+		name     string
+		creators map[string]map[string]any
+		want     map[string]map[string]any
+		wantErr  bool
+	}{
+		{
+			name: "normalized keys",
+			creators: map[string]map[string]any{
+				"creator1":                    {"skip-files": true},
+				"@creator2":                   {"save-dir": "/creator2"},
+				"@12345":                      {"concurrency": 1},
+				"https://creator3.fanbox.cc/": {"dir-by-post": true},
+			},
+			want: map[string]map[string]any{
+				"creator1": {"skip-files": true},
+				"creator2": {"save-dir": "/creator2"},
+				"12345":    {"concurrency": 1},
+				"creator3": {"dir-by-post": true},
+			},
+		},
+		{
+			name: "duplicated creators",
+			creators: map[string]map[string]any{
+				"creator1":  {"skip-files": true},
+				"@creator1": {"skip-images": true},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := creatorOverrides(context.Background(), lister, &config{Creators: tt.creators})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCreatorFlagsDocumented(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "..", "README.md"))
+	require.NoError(t, err)
+
+	var line string
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(l, "The `creators` section overrides options") {
+			line = l
+		}
+	}
+	require.NotEmpty(t, line, "README should list options of the creators section")
+	for _, f := range creatorFlags {
+		assert.Contains(t, line, "`"+f.Names()[0]+"`")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+)
+
+var sinceFlag = &cli.StringFlag{
+	Name:  "since",
+	Usage: "Download only posts published at or after the date (2006-01-02) or date time (RFC 3339).",
+}
+var untilFlag = &cli.StringFlag{
+	Name:  "until",
+	Usage: "Download only posts published before the date time (RFC 3339), or until the end of the date (2006-01-02).",
+}
+var minFeeFlag = &cli.IntFlag{
+	Name:  "min-fee",
+	Value: -1,
+	Usage: "Download only posts whose fee is at least the yen. If this is negative, the fee is not limited.",
+}
+var maxFeeFlag = &cli.IntFlag{
+	Name:  "max-fee",
+	Value: -1,
+	Usage: "Download only posts whose fee is at most the yen, 0 downloads only free posts. If this is negative, the fee is not limited.",
+}
+var titleFlag = &cli.StringFlag{
+	Name:  "title",
+	Usage: "Download only posts whose titles match the regular expression.",
+}
+var excludeTitleFlag = &cli.StringFlag{
+	Name:  "exclude-title",
+	Usage: "Skip posts whose titles match the regular expression.",
+}
+var tagFlag = &cli.StringFlag{
+	Name:  "tag",
+	Usage: "Comma separated tags, download only posts which have any of them.",
+}
+var excludeTagFlag = &cli.StringFlag{
+	Name:  "exclude-tag",
+	Usage: "Comma separated tags, skip posts which have any of them.",
+}
+var postIDFlag = &cli.StringFlag{
+	Name:  "post-id",
+	Usage: "Comma separated post IDs, download only them.",
+}
+
+// newPostFilter returns the post filter, or nil if no filter flags are set.
+func newPostFilter(c flagSource) (*fanbox.PostFilter, error) {
+	f := &fanbox.PostFilter{
+		Tags:        splitList(c.String(tagFlag.Name)),
+		ExcludeTags: splitList(c.String(excludeTagFlag.Name)),
+		PostIDs:     splitList(c.String(postIDFlag.Name)),
+	}
+
+	var err error
+	if f.Since, err = parseFilterTime(c.String(sinceFlag.Name), false); err != nil {
+		return nil, fmt.Errorf("--%s: %w", sinceFlag.Name, err)
+	}
+	if f.Until, err = parseFilterTime(c.String(untilFlag.Name), true); err != nil {
+		return nil, fmt.Errorf("--%s: %w", untilFlag.Name, err)
+	}
+	if v := c.Int(minFeeFlag.Name); v >= 0 {
+		f.MinFee = &v
+	}
+	if v := c.Int(maxFeeFlag.Name); v >= 0 {
+		f.MaxFee = &v
+	}
+	if v := c.String(titleFlag.Name); v != "" {
+		if f.Title, err = regexp.Compile(v); err != nil {
+			return nil, fmt.Errorf("--%s: %w", titleFlag.Name, err)
+		}
+	}
+	if v := c.String(excludeTitleFlag.Name); v != "" {
+		if f.ExcludeTitle, err = regexp.Compile(v); err != nil {
+			return nil, fmt.Errorf("--%s: %w", excludeTitleFlag.Name, err)
+		}
+	}
+
+	if f.Since.IsZero() && f.Until.IsZero() && f.MinFee == nil && f.MaxFee == nil && f.Title == nil &&
+		f.ExcludeTitle == nil && len(f.Tags) == 0 && len(f.ExcludeTags) == 0 && len(f.PostIDs) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// parseFilterTime parses a date in the local time zone or a date time.
+// If endOfDate is true, a date is parsed as the start of the next date.
+func parseFilterTime(v string, endOfDate bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+		if endOfDate {
+			return t.AddDate(0, 0, 1), nil
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither 2006-01-02 nor RFC 3339", v)
+	}
+	return t, nil
+}
+
+// splitList splits the comma separated values, and drops empty ones.
+func splitList(v string) []string {
+	var res []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
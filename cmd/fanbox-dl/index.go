@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+)
+
+var indexCommand = &cli.Command{
+	Name:  "index",
+	Usage: "Manage the SQLite download index.",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "rebuild",
+			Usage: "Record assets in --save-dir into the download index.",
+			Flags: []cli.Flag{
+				configFlag,
+				saveDirFlag,
+				indexDBFlag,
+				verboseFlag,
+				logFormatFlag,
+			},
+			Action: func(c *cli.Context) error {
+				if _, err := applyConfig(c); err != nil {
+					return err
+				}
+				if err := initLogger(c, os.Stdout); err != nil {
+					return err
+				}
+				if c.String(indexDBFlag.Name) == "" {
+					return fmt.Errorf("--%s is required", indexDBFlag.Name)
+				}
+
+				idx, err := fanbox.OpenSQLiteIndex(c.Context, c.String(indexDBFlag.Name))
+				if err != nil {
+					return fmt.Errorf("open download index: %w", err)
+				}
+				defer func() {
+					_ = idx.Close()
+				}()
+
+				startedAt := time.Now()
+				n, err := fanbox.RebuildIndex(c.Context, idx, c.String(saveDirFlag.Name))
+				if err != nil {
+					return fmt.Errorf("rebuild download index: %w", err)
+				}
+
+				slog.InfoContext(c.Context, "Completed.", "assets", n, "duration", time.Since(startedAt).Round(time.Millisecond*100))
+				return nil
+			},
+		},
+	},
+}
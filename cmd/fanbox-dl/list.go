@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+)
+
+var outputFlag = &cli.StringFlag{
+	Name:    "output",
+	Aliases: []string{"o"},
+	Value:   "table",
+	Usage:   `Output format, "table" or "json".`,
+}
+
+var listCreatorsCommand = &cli.Command{
+	Name:  "list-creators",
+	Usage: "List creators to download, with where they are found.",
+	Flags: []cli.Flag{
+		configFlag,
+		creatorFlag,
+		ignoreCreatorFlag,
+		supportingFlag,
+		followingFlag,
+		sessIDFlag,
+		cookieFlag,
+		cookieFileFlag,
+		userAgentFlag,
+		apiRPSFlag,
+		downloadRPSFlag,
+		outputFlag,
+		verboseFlag,
+		logFormatFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if err := initListing(c); err != nil {
+			return err
+		}
+		api, err := newAPIClient(c)
+		if err != nil {
+			return err
+		}
+
+		in := &fanbox.CreatorIDListerDoInput{
+			IncludeSupporting: c.Bool(supportingFlag.Name),
+			IncludeFollowing:  c.Bool(followingFlag.Name),
+			InputCreatorIDs:   splitList(c.String(creatorFlag.Name)),
+			IgnoreCreatorIDs:  splitList(c.String(ignoreCreatorFlag.Name)),
+		}
+		creators, err := (&fanbox.CreatorIDLister{OfficialAPIClient: api}).List(c.Context, in)
+		if err != nil {
+			return fmt.Errorf("list creators: %w", err)
+		}
+
+		rows := make([][]string, 0, len(creators))
+		for _, cr := range creators {
+			var plan, fee string
+			if cr.SupportingPlan != nil {
+				plan = cr.SupportingPlan.Title
+				fee = strconv.Itoa(cr.SupportingPlan.Fee)
+			}
+			rows = append(rows, []string{cr.CreatorID, strings.Join(cr.Sources, ","), plan, fee})
+		}
+		return writeOutput(c, creators, []string{"CREATOR", "SOURCES", "PLAN", "FEE"}, rows)
+	},
+}
+
+var listPostsCommand = &cli.Command{
+	Name:      "list-posts",
+	Usage:     "List posts of the creator, given in the same forms as --creator.",
+	ArgsUsage: "<creator>",
+	Flags: []cli.Flag{
+		configFlag,
+		sessIDFlag,
+		cookieFlag,
+		cookieFileFlag,
+		userAgentFlag,
+		apiRPSFlag,
+		downloadRPSFlag,
+		outputFlag,
+		verboseFlag,
+		logFormatFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if err := initListing(c); err != nil {
+			return err
+		}
+		if c.NArg() != 1 {
+			return fmt.Errorf("a creator ID is required")
+		}
+		api, err := newAPIClient(c)
+		if err != nil {
+			return err
+		}
+
+		// the creator is given in the same forms as --creator
+		ids, err := (&fanbox.CreatorIDLister{OfficialAPIClient: api}).Resolve(c.Context, []string{c.Args().First()})
+		if err != nil {
+			return err
+		}
+
+		posts, err := (&fanbox.Client{OfficialAPIClient: api}).ListPosts(c.Context, ids[0])
+		if err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(posts))
+		for _, p := range posts {
+			rows = append(rows, []string{p.ID, p.PublishedDateTime, strconv.Itoa(p.FeeRequired), strconv.FormatBool(p.IsRestricted), p.Title})
+		}
+		return writeOutput(c, posts, []string{"ID", "PUBLISHED", "FEE", "RESTRICTED", "TITLE"}, rows)
+	},
+}
+
+// infoAsset is an asset in the output of info.
+type infoAsset struct {
+	Type      string `json:"type"`
+	Order     int    `json:"order"`
+	ID        string `json:"id"`
+	Extension string `json:"extension"`
+	URL       string `json:"url"`
+}
+
+var infoCommand = &cli.Command{
+	Name:      "info",
+	Usage:     "Show the post and its downloadable assets.",
+	ArgsUsage: "<post-id>",
+	Flags: []cli.Flag{
+		configFlag,
+		sessIDFlag,
+		cookieFlag,
+		cookieFileFlag,
+		userAgentFlag,
+		apiRPSFlag,
+		downloadRPSFlag,
+		downloadEmbedsFlag,
+		ytDlpFlag,
+		outputFlag,
+		verboseFlag,
+		logFormatFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if err := initListing(c); err != nil {
+			return err
+		}
+		if c.NArg() != 1 {
+			return fmt.Errorf("a post ID is required")
+		}
+		api, err := newAPIClient(c)
+		if err != nil {
+			return err
+		}
+
+		client := &fanbox.Client{OfficialAPIClient: api, Extractors: newExtractors(c)}
+		post, err := client.GetPost(c.Context, c.Args().First())
+		if err != nil {
+			return err
+		}
+		assets, err := client.ListPostAssets(post)
+		if err != nil {
+			return err
+		}
+
+		out := struct {
+			URL    string      `json:"url"`
+			Post   fanbox.Post `json:"post"`
+			Assets []infoAsset `json:"assets"`
+		}{URL: post.URL(), Post: post, Assets: make([]infoAsset, 0, len(assets))}
+		rows := make([][]string, 0, len(assets))
+		for _, a := range assets {
+			ia := infoAsset{
+				Type:      a.Type,
+				Order:     a.Order,
+				ID:        a.Downloadable.GetID(),
+				Extension: a.Downloadable.GetExtension(),
+				URL:       a.Downloadable.GetURL(),
+			}
+			if e, ok := a.Downloadable.(fanbox.EmbeddedAsset); ok && ia.URL == "" {
+				ia.URL = e.PageURL
+			}
+			out.Assets = append(out.Assets, ia)
+			rows = append(rows, []string{ia.Type, strconv.Itoa(ia.Order), ia.ID, ia.Extension, ia.URL})
+		}
+
+		if c.String(outputFlag.Name) == "table" {
+			fmt.Fprintf(c.App.Writer, "Title:\t%s\nURL:\t%s\nType:\t%s\nPublished:\t%s\nFee:\t%d\nRestricted:\t%t\n\n",
+				post.Title, post.URL(), post.Type, post.PublishedDateTime, post.FeeRequired, post.IsRestricted)
+		}
+		return writeOutput(c, out, []string{"TYPE", "ORDER", "ID", "EXTENSION", "URL"}, rows)
+	},
+}
+
+// initListing applies the config file, and initializes the logger to write logs to stderr,
+// because results are written to stdout.
+func initListing(c *cli.Context) error {
+	if _, err := applyConfig(c); err != nil {
+		return err
+	}
+	if err := initLogger(c, os.Stderr); err != nil {
+		return err
+	}
+
+	switch c.String(outputFlag.Name) {
+	case "table", "json":
+		return nil
+	default:
+		return fmt.Errorf("--%s must be table or json", outputFlag.Name)
+	}
+}
+
+// writeOutput writes v as JSON, or rows as a table by --output.
+func writeOutput(c *cli.Context, v any, header []string, rows [][]string) error {
+	if c.String(outputFlag.Name) == "json" {
+		enc := json.NewEncoder(c.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
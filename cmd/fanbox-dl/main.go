@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -18,23 +20,9 @@ import (
 	"github.com/hareku/fanbox-dl/pkg/fanbox"
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
 )
 
-func resolveSessionID(c *cli.Context) string {
-	if v := c.String(sessIDFlag.Name); v != "" {
-		return v
-	}
-
-	if v := os.Getenv("FANBOXSESSID"); v != "" {
-		return v
-	}
-	if v := os.Getenv("FANBOX_COOKIE"); v != "" {
-		return v
-	}
-
-	return ""
-}
-
 var (
 	version = "dev"
 	commit  = "none"
@@ -48,17 +36,18 @@ var versionFlag = &cli.BoolFlag{
 }
 var creatorFlag = &cli.StringFlag{
 	Name:     "creator",
-	Usage:    "Comma separated creator IDs to download. DO NOT prepend '@' to the creator ID.",
+	Usage:    "Comma separated creators to download, creator IDs, '@' prefixed creator IDs, pixiv user IDs or URLs of creator pages. Digits are pixiv user IDs, or creator IDs if no creator has the pixiv user ID. Prefix '@' to always use digits as a creator ID.",
 	Required: false,
 }
 var ignoreCreatorFlag = &cli.StringFlag{
 	Name:     "ignore-creator",
-	Usage:    "Comma separated creator IDs to ignore to download.",
+	Usage:    "Comma separated creators to ignore to download, in the same forms as --creator.",
 	Required: false,
 }
 var sessIDFlag = &cli.StringFlag{
 	Name:     "sessid",
 	Usage:    "FANBOXSESSID which is stored in Cookies. If this is not set, fanbox-dl refers FANBOXSESSID environment value.",
+	EnvVars:  []string{"FANBOXSESSID", "FANBOX_COOKIE"},
 	Required: false,
 }
 var cookieFlag = &cli.StringFlag{
@@ -66,16 +55,43 @@ var cookieFlag = &cli.StringFlag{
 	Usage:    "Cookie for Fanbox API. This value overrides FANBOXSESSID.",
 	Required: false,
 }
+var cookieFileFlag = &cli.StringFlag{
+	Name:     "cookie-file",
+	Usage:    "Netscape cookie file, JSON cookies exported by browser extensions, or Firefox cookies.sqlite (or its profile directory). Cookies of fanbox.cc are used, and --cookie overrides this.",
+	Required: false,
+}
 var userAgentFlag = &cli.StringFlag{
 	Name:  "user-agent",
 	Usage: "User-Agent for Fanbox API.",
 	Value: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36",
 }
+var apiRPSFlag = &cli.Float64Flag{
+	Name:  "api-rps",
+	Value: 2,
+	Usage: "Maximum requests per second to the FANBOX API. If this is 0, requests are not limited.",
+}
+var downloadRPSFlag = &cli.Float64Flag{
+	Name:  "download-rps",
+	Value: 0,
+	Usage: "Maximum requests per second to download assets. If this is 0, requests are not limited.",
+}
+var limitRateFlag = &cli.StringFlag{
+	Name:  "limit-rate",
+	Usage: `Maximum bytes per second of all downloads, such as "2M". Rates can be scheduled by time ranges of the day, such as "09:00-18:00=1M,22:00-06:00=0,4M" where 0 is unlimited and the last rate is the default.`,
+}
 var saveDirFlag = &cli.StringFlag{
 	Name:  "save-dir",
 	Value: "./images",
 	Usage: "Directory to save images.",
 }
+var storageFlag = &cli.StringFlag{
+	Name:  "storage",
+	Usage: "Storage URL to save assets, e.g. s3://bucket/prefix?endpoint=http://localhost:9000. If this is not set, assets are saved into --save-dir.",
+}
+var indexDBFlag = &cli.StringFlag{
+	Name:  "index-db",
+	Usage: "Path to the SQLite download index. If this is set, downloaded assets are recorded with their sizes and SHA-256 hashes, and not downloaded again even if they were renamed or moved. The hashes are not saved without it, and verify command requires it.",
+}
 var dirByPostFlag = &cli.BoolFlag{
 	Name:  "dir-by-post",
 	Value: false,
@@ -86,6 +102,21 @@ var dirByPlanFlag = &cli.BoolFlag{
 	Value: false,
 	Usage: "Whether to separate save directories by plan.",
 }
+var pathTemplateFlag = &cli.StringFlag{
+	Name:  "path-template",
+	Value: "",
+	Usage: "Go template of asset paths, or a preset name (" + strings.Join(fanbox.PathTemplatePresetNames(), ", ") + "). It overrides --dir-by-post and --dir-by-plan.",
+}
+var originalFileNamesFlag = &cli.BoolFlag{
+	Name:  "original-file-names",
+	Value: false,
+	Usage: "Whether to name files by their uploaded names instead of IDs, files already saved by IDs are not downloaded again.",
+}
+var postPathTemplateFlag = &cli.StringFlag{
+	Name:  "post-path-template",
+	Value: "",
+	Usage: "Go template of paths of post.json and rendered posts, used with --path-template. It replaces the document paths of a preset.",
+}
 var allFlag = &cli.BoolFlag{
 	Name:  "all",
 	Value: false,
@@ -111,6 +142,28 @@ var skipImages = &cli.BoolFlag{
 	Value: false,
 	Usage: "Whether to skip downloading images.",
 }
+var skipPostMetadataFlag = &cli.BoolFlag{
+	Name:  "skip-post-metadata",
+	Value: false,
+	Usage: "Whether to skip saving post.json which contains the text and metadata of each post.",
+}
+var renderPostsFlag = &cli.BoolFlag{
+	Name:  "render-posts",
+	Value: false,
+	Usage: "Whether to render posts into index.md and index.html which link to saved images and files.",
+}
+
+var downloadEmbedsFlag = &cli.BoolFlag{
+	Name:  "download-embeds",
+	Value: false,
+	Usage: "Whether to download videos uploaded to FANBOX and files shared by Dropbox and Google Drive links in posts.",
+}
+
+var ytDlpFlag = &cli.StringFlag{
+	Name:  "yt-dlp",
+	Value: "",
+	Usage: "Path to yt-dlp, if it is set, embedded YouTube, Vimeo and SoundCloud content is downloaded by it.",
+}
 var dryRunFlag = &cli.BoolFlag{
 	Name:  "dry-run",
 	Value: false,
@@ -121,133 +174,494 @@ var verboseFlag = &cli.BoolFlag{
 	Value: false,
 	Usage: "Whether to output debug logs.",
 }
+var logFormatFlag = &cli.StringFlag{
+	Name:  "log-format",
+	Value: applog.FormatText,
+	Usage: `Log format, "text" or "json".`,
+}
+var summaryFlag = &cli.StringFlag{
+	Name:  "summary",
+	Usage: `File to write the JSON summary of the run for each creator, or "-" to write it to stdout instead of logs.`,
+}
 var skipOnErrorFlag = &cli.BoolFlag{
 	Name:  "skip-on-error",
 	Value: false,
 	Usage: "Whether to skip downloading instead of exiting when an error occurred.",
 }
+var concurrencyFlag = &cli.IntFlag{
+	Name:  "concurrency",
+	Value: 1,
+	Usage: "Number of assets of a post to download concurrently.",
+}
+var creatorConcurrencyFlag = &cli.IntFlag{
+	Name:  "creator-concurrency",
+	Value: 1,
+	Usage: "Number of creators to download concurrently.",
+}
 var removeUnprintableCharsFlag = &cli.BoolFlag{
 	Name:  "remove-unprintable-chars",
 	Value: false,
 	Usage: "Whether to remove unprintable characters from file names.",
 }
 
+// downloadFlags are the flags of download, which are also accepted without the download command.
+var downloadFlags = []cli.Flag{
+	versionFlag,
+	configFlag,
+	creatorFlag,
+	ignoreCreatorFlag,
+	urlFlag,
+	urlFileFlag,
+	sessIDFlag,
+	cookieFlag,
+	cookieFileFlag,
+	saveDirFlag,
+	storageFlag,
+	indexDBFlag,
+	dirByPostFlag,
+	dirByPlanFlag,
+	pathTemplateFlag,
+	postPathTemplateFlag,
+	originalFileNamesFlag,
+	userAgentFlag,
+	apiRPSFlag,
+	downloadRPSFlag,
+	limitRateFlag,
+	skipSessionCheckFlag,
+	allFlag,
+	supportingFlag,
+	followingFlag,
+	skipFiles,
+	skipImages,
+	skipPostMetadataFlag,
+	renderPostsFlag,
+	downloadEmbedsFlag,
+	ytDlpFlag,
+	dryRunFlag,
+	verboseFlag,
+	logFormatFlag,
+	summaryFlag,
+	skipOnErrorFlag,
+	removeUnprintableCharsFlag,
+	concurrencyFlag,
+	creatorConcurrencyFlag,
+	sinceFlag,
+	untilFlag,
+	minFeeFlag,
+	maxFeeFlag,
+	titleFlag,
+	excludeTitleFlag,
+	tagFlag,
+	excludeTagFlag,
+	postIDFlag,
+}
+
 var app = &cli.App{
 	Name:  "fanbox-dl",
 	Usage: "This CLI downloads images of supporting and following creators.",
-	Flags: []cli.Flag{
-		versionFlag,
-		creatorFlag,
-		ignoreCreatorFlag,
-		sessIDFlag,
-		cookieFlag,
-		saveDirFlag,
-		dirByPostFlag,
-		dirByPlanFlag,
-		userAgentFlag,
-		allFlag,
-		supportingFlag,
-		followingFlag,
-		skipFiles,
-		skipImages,
-		dryRunFlag,
-		verboseFlag,
-		skipOnErrorFlag,
-		removeUnprintableCharsFlag,
+	Flags: downloadFlags,
+	Commands: []*cli.Command{
+		downloadCommand,
+		listCreatorsCommand,
+		listPostsCommand,
+		infoCommand,
+		whoamiCommand,
+		indexCommand,
+		verifyCommand,
+		migrateCommand,
 	},
-	Action: func(c *cli.Context) error {
-		applog.InitLogger(c.Bool(verboseFlag.Name))
-		slog.Info("Launching Pixiv FANBOX Downloader!", "version", version, "commit", commit, "date", date)
-		if c.Bool(versionFlag.Name) {
-			return nil
+	Action: download,
+}
+
+var downloadCommand = &cli.Command{
+	Name:   "download",
+	Usage:  "Download posts of creators, which is the same as running without commands.",
+	Flags:  downloadFlags,
+	Action: download,
+}
+
+// download downloads posts of creators resolved by the flags.
+func download(c *cli.Context) error {
+	cfg, err := applyConfig(c)
+	if err != nil {
+		return err
+	}
+
+	logWriter := os.Stdout
+	if c.String(summaryFlag.Name) == "-" {
+		// stdout is for the summary
+		logWriter = os.Stderr
+	}
+	if err := initLogger(c, logWriter); err != nil {
+		return err
+	}
+	slog.Info("Launching Pixiv FANBOX Downloader!", "version", version, "commit", commit, "date", date)
+	if c.Bool(versionFlag.Name) {
+		return nil
+	}
+
+	if c.Int(creatorConcurrencyFlag.Name) < 1 {
+		return fmt.Errorf("--%s must be 1 or more", creatorConcurrencyFlag.Name)
+	}
+
+	api, err := newAPIClient(c)
+	if err != nil {
+		return err
+	}
+	if !c.Bool(skipSessionCheckFlag.Name) {
+		if err := checkSession(c.Context, api); err != nil {
+			return err
 		}
+	}
 
-		var cookieStr string
-		if sessID := resolveSessionID(c); sessID != "" {
-			slog.Debug("Using session ID", "sessid_bytes", len(sessID))
-			cookieStr = fmt.Sprintf("FANBOXSESSID=%s", sessID)
+	var idx *fanbox.SQLiteIndex
+	if v := c.String(indexDBFlag.Name); v != "" {
+		idx, err = fanbox.OpenSQLiteIndex(c.Context, v)
+		if err != nil {
+			return fmt.Errorf("open download index: %w", err)
 		}
-		if v := c.String(cookieFlag.Name); v != "" {
-			if cookieStr != "" {
-				slog.Warn("session ID and cookie are set, cookie option overrides session ID option")
-			}
-			slog.Debug("Using cookie", "cookie_bytes", len(v))
-			cookieStr = v
+		defer func() {
+			_ = idx.Close()
+		}()
+	}
+
+	// the bandwidth is shared by all clients
+	var bandwidth *fanbox.BandwidthLimiter
+	if v := c.String(limitRateFlag.Name); v != "" {
+		bandwidth, err = fanbox.ParseBandwidthLimit(v)
+		if err != nil {
+			return fmt.Errorf("--%s: %w", limitRateFlag.Name, err)
 		}
+	}
 
-		httpClient := retryablehttp.NewClient()
-		httpClient.Logger = slog.Default()
-		httpClient.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
-			if err != nil {
-				return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
-			}
-			b, err := fanbox.IsFailedToThumbnailingErr(resp)
-			if err == nil && b {
-				return false, fanbox.ErrFailedToThumbnailing
+	defaultClient, err := newClient(c, api, idx)
+	if err != nil {
+		return err
+	}
+	defaultClient.Bandwidth = bandwidth
+
+	ctx := c.Context
+	startedAt := time.Now()
+	idLister := &fanbox.CreatorIDLister{
+		OfficialAPIClient: api,
+	}
+
+	overrides, err := creatorOverrides(ctx, idLister, cfg)
+	if err != nil {
+		return err
+	}
+	creatorClients := make(map[string]*fanbox.Client, len(overrides))
+	clients := []*fanbox.Client{defaultClient}
+	for id, o := range overrides {
+		creatorClients[id], err = newClient(creatorFlagSource{Context: c, overrides: o}, api, idx)
+		if err != nil {
+			return fmt.Errorf("creator %q: %w", id, err)
+		}
+		creatorClients[id].Bandwidth = bandwidth
+		clients = append(clients, creatorClients[id])
+	}
+	if err := removePartFiles(ctx, clients); err != nil {
+		return err
+	}
+
+	refs, err := readPostURLs(c)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	// postIDs are posts to download of creators by --url, creators are not listed then
+	postIDs := make(map[string][]string)
+	if len(refs) > 0 {
+		for _, ref := range refs {
+			if _, ok := postIDs[ref.CreatorID]; !ok {
+				ids = append(ids, ref.CreatorID)
 			}
-			return retryablehttp.DefaultRetryPolicy(ctx, resp, nil)
+			postIDs[ref.CreatorID] = append(postIDs[ref.CreatorID], ref.PostID)
+		}
+	} else {
+		in := &fanbox.CreatorIDListerDoInput{
+			IncludeSupporting: c.Bool(supportingFlag.Name),
+			IncludeFollowing:  c.Bool(followingFlag.Name),
+			InputCreatorIDs:   splitList(c.String(creatorFlag.Name)),
+			IgnoreCreatorIDs:  splitList(c.String(ignoreCreatorFlag.Name)),
 		}
 
-		tlsTransp, err := tlsclient.NewTransportWithOptions(tls_client.NewNoopLogger(), tls_client.WithClientProfile(profiles.Chrome_131))
+		ids, err = idLister.Do(ctx, in)
 		if err != nil {
-			return fmt.Errorf("create tls transport: %w", err)
+			return fmt.Errorf("resolve creator IDs: %w", err)
+		}
+	}
+
+	summaries := make([]*fanbox.RunSummary, len(ids))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.Int(creatorConcurrencyFlag.Name))
+	for i, id := range ids {
+		client, ok := creatorClients[id]
+		if !ok {
+			client = defaultClient
 		}
-		httpClient.HTTPClient.Transport = tlsTransp
+		g.Go(func() error {
+			slog.InfoContext(gctx, "Start downloading", "creator_id", id)
+			var (
+				s   *fanbox.RunSummary
+				err error
+			)
+			if pids, ok := postIDs[id]; ok {
+				s, err = client.RunPosts(gctx, id, pids)
+			} else {
+				s, err = client.RunWithSummary(gctx, id)
+			}
+			summaries[i] = s
+			if errors.Is(err, fanbox.ErrCreatorNotFound) {
+				slog.WarnContext(gctx, "Creator is not found, skipped", "creator_id", id, "error", err)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed downloading of %q: %w", id, err)
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+	// the summary is written even if downloading failed, to know how far it went
+	if werr := writeSummary(c, summaries); werr != nil {
+		return errors.Join(err, werr)
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Completed.", "duration", time.Since(startedAt).Round(time.Millisecond*100))
+	return nil
+}
+
+// writeSummary writes summaries of creators to --summary as JSON, creators not started are omitted.
+func writeSummary(c *cli.Context, summaries []*fanbox.RunSummary) error {
+	dst := c.String(summaryFlag.Name)
+	if dst == "" {
+		return nil
+	}
 
-		api := &fanbox.OfficialAPIClient{
-			HTTPClient: httpClient,
-			Cookie:     cookieStr,
-			UserAgent:  c.String(userAgentFlag.Name),
+	out := struct {
+		Creators []*fanbox.RunSummary `json:"creators"`
+	}{Creators: make([]*fanbox.RunSummary, 0, len(summaries))}
+	for _, s := range summaries {
+		if s != nil {
+			out.Creators = append(out.Creators, s)
 		}
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal summary: %w", err)
+	}
+	b = append(b, '\n')
 
-		client := &fanbox.Client{
-			CheckAllPosts:     c.Bool(allFlag.Name),
-			DryRun:            c.Bool(dryRunFlag.Name),
-			SkipFiles:         c.Bool(skipFiles.Name),
-			SkipImages:        c.Bool(skipImages.Name),
-			SkipOnError:       c.Bool(skipOnErrorFlag.Name),
-			OfficialAPIClient: api,
-			Storage: &fanbox.LocalStorage{
-				SaveDir:   c.String(saveDirFlag.Name),
-				DirByPost: c.Bool(dirByPostFlag.Name),
-				DirByPlan: c.Bool(dirByPlanFlag.Name),
-
-				RemoveUnprintableChars: c.Bool(removeUnprintableCharsFlag.Name),
-			},
+	if dst == "-" {
+		_, err = c.App.Writer.Write(b)
+	} else {
+		err = os.WriteFile(dst, b, 0664)
+	}
+	if err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	return nil
+}
+
+// initLogger initializes the logger with --verbose and --log-format.
+func initLogger(c *cli.Context, w io.Writer) error {
+	if err := applog.InitLoggerWithOptions(applog.Options{
+		Writer:  w,
+		Verbose: c.Bool(verboseFlag.Name),
+		Format:  c.String(logFormatFlag.Name),
+	}); err != nil {
+		return fmt.Errorf("--%s: %w", logFormatFlag.Name, err)
+	}
+	return nil
+}
+
+func newAPIClient(c *cli.Context) (*fanbox.OfficialAPIClient, error) {
+	var cookieStr string
+	if sessID := c.String(sessIDFlag.Name); sessID != "" {
+		slog.Debug("Using session ID", "sessid_bytes", len(sessID))
+		cookieStr = fmt.Sprintf("FANBOXSESSID=%s", sessID)
+	}
+	if name := c.String(cookieFileFlag.Name); name != "" {
+		v, err := readCookieFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("read --%s: %w", cookieFileFlag.Name, err)
 		}
+		if cookieStr != "" {
+			slog.Warn("session ID and cookie file are set, cookie file overrides session ID option")
+		}
+		cookieStr = v
+	}
+	if v := c.String(cookieFlag.Name); v != "" {
+		if cookieStr != "" {
+			slog.Warn("session ID or cookie file are set with cookie, cookie option overrides them")
+		}
+		slog.Debug("Using cookie", "cookie_bytes", len(v))
+		cookieStr = v
+	}
 
-		ctx := c.Context
-		startedAt := time.Now()
+	limiter := fanbox.NewRateLimiter(c.Float64(apiRPSFlag.Name), c.Float64(downloadRPSFlag.Name))
 
-		idLister := &fanbox.CreatorIDLister{
-			OfficialAPIClient: api,
+	httpClient := retryablehttp.NewClient()
+	httpClient.Logger = slog.Default()
+	// 429 and 503 are retried by the default policy, and Retry-After of them is honored by the backoff
+	httpClient.Backoff = limiter.Backoff
+	// retries wait for the budget too
+	httpClient.PrepareRetry = limiter.PrepareRetry
+	// the last response is returned after retries, to classify it as fanbox.APIError
+	httpClient.ErrorHandler = retryablehttp.PassthroughErrorHandler
+	httpClient.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if err != nil {
+			return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
 		}
+		b, err := fanbox.IsFailedToThumbnailingErr(resp)
+		if err == nil && b {
+			return false, fanbox.ErrFailedToThumbnailing
+		}
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, nil)
+	}
 
-		in := &fanbox.CreatorIDListerDoInput{
-			IncludeSupporting: c.Bool(supportingFlag.Name),
-			IncludeFollowing:  c.Bool(followingFlag.Name),
+	tlsTransp, err := tlsclient.NewTransportWithOptions(tls_client.NewNoopLogger(), tls_client.WithClientProfile(profiles.Chrome_131))
+	if err != nil {
+		return nil, fmt.Errorf("create tls transport: %w", err)
+	}
+	httpClient.HTTPClient.Transport = tlsTransp
+
+	return &fanbox.OfficialAPIClient{
+		HTTPClient:  httpClient,
+		Cookie:      cookieStr,
+		UserAgent:   c.String(userAgentFlag.Name),
+		RateLimiter: limiter,
+	}, nil
+}
+
+// newClient creates the client for downloading with the flag values.
+func newClient(f flagSource, api *fanbox.OfficialAPIClient, idx *fanbox.SQLiteIndex) (*fanbox.Client, error) {
+	if f.Int(concurrencyFlag.Name) < 1 {
+		return nil, fmt.Errorf("--%s must be 1 or more", concurrencyFlag.Name)
+	}
+
+	client := &fanbox.Client{
+		CheckAllPosts:     f.Bool(allFlag.Name),
+		DryRun:            f.Bool(dryRunFlag.Name),
+		SkipFiles:         f.Bool(skipFiles.Name),
+		SkipImages:        f.Bool(skipImages.Name),
+		SkipOnError:       f.Bool(skipOnErrorFlag.Name),
+		SavePostMetadata:  !f.Bool(skipPostMetadataFlag.Name),
+		RenderPosts:       f.Bool(renderPostsFlag.Name),
+		Concurrency:       f.Int(concurrencyFlag.Name),
+		OfficialAPIClient: api,
+		Extractors:        newExtractors(f),
+	}
+	var err error
+	client.Filter, err = newPostFilter(f)
+	if err != nil {
+		return nil, err
+	}
+	if idx != nil { // not to set a typed nil to the interface
+		client.Index = idx
+	}
+
+	client.Storage, err = newStorage(f)
+	if err != nil {
+		return nil, fmt.Errorf("create storage: %w", err)
+	}
+	return client, nil
+}
+
+// removePartFiles removes partial files of interrupted downloads once per save dir of the clients.
+// Dry runs leave them as they are.
+func removePartFiles(ctx context.Context, clients []*fanbox.Client) error {
+	removed := make(map[string]bool)
+	for _, client := range clients {
+		ls, ok := client.Storage.(*fanbox.LocalStorage)
+		if !ok || client.DryRun || removed[ls.Root()] {
+			continue
 		}
-		if c.String(creatorFlag.Name) != "" {
-			in.InputCreatorIDs = strings.Split(c.String(creatorFlag.Name), ",")
+		removed[ls.Root()] = true
+
+		n, err := ls.RemovePartFiles()
+		if err != nil {
+			return fmt.Errorf("remove partial files: %w", err)
 		}
-		if c.String(ignoreCreatorFlag.Name) != "" {
-			in.IgnoreCreatorIDs = strings.Split(c.String(ignoreCreatorFlag.Name), ",")
+		if n > 0 {
+			slog.InfoContext(ctx, "Removed partial files of interrupted downloads", "save_dir", ls.SaveDir, "files", n)
 		}
+	}
+	return nil
+}
 
-		ids, err := idLister.Do(ctx, in)
+func newStorage(c flagSource) (fanbox.Storage, error) {
+	if v := c.String(storageFlag.Name); v != "" {
+		s, err := fanbox.NewS3StorageFromURL(v)
 		if err != nil {
-			return fmt.Errorf("resolve creator IDs: %w", err)
+			return nil, err
 		}
-		for _, id := range ids {
-			slog.InfoContext(ctx, "Start downloading", "creator_id", id)
-			if err := client.Run(ctx, id); err != nil {
-				return fmt.Errorf("failed downloading of %q: %w", id, err)
-			}
+		s.DirByPost = c.Bool(dirByPostFlag.Name)
+		s.DirByPlan = c.Bool(dirByPlanFlag.Name)
+		s.RemoveUnprintableChars = c.Bool(removeUnprintableCharsFlag.Name)
+		s.OriginalFileNames = c.Bool(originalFileNamesFlag.Name)
+		s.PathTemplate, err = newPathTemplate(c)
+		if err != nil {
+			return nil, err
 		}
+		return s, nil
+	}
 
-		slog.InfoContext(ctx, "Completed.", "duration", time.Since(startedAt).Round(time.Millisecond*100))
-		return nil
-	},
+	return newLocalStorage(c)
+}
+
+// newPathTemplate returns the path template, or nil if --path-template is not set.
+func newPathTemplate(c flagSource) (*fanbox.PathTemplate, error) {
+	v := c.String(pathTemplateFlag.Name)
+	if v == "" {
+		if c.String(postPathTemplateFlag.Name) != "" {
+			return nil, fmt.Errorf("--%s requires --%s", postPathTemplateFlag.Name, pathTemplateFlag.Name)
+		}
+		return nil, nil
+	}
+
+	t, err := fanbox.NewPathTemplate(v, c.String(postPathTemplateFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("--%s: %w", pathTemplateFlag.Name, err)
+	}
+	return t, nil
+}
+
+// newExtractors returns the extractors enabled by the flags, or nil if embeds are not downloaded.
+func newExtractors(c flagSource) *fanbox.ExtractorRegistry {
+	var r *fanbox.ExtractorRegistry
+	if c.Bool(downloadEmbedsFlag.Name) {
+		r = fanbox.NewExtractorRegistry()
+	}
+	if v := c.String(ytDlpFlag.Name); v != "" {
+		if r == nil {
+			r = &fanbox.ExtractorRegistry{}
+		}
+		r.Register(fanbox.NewYtDlpExtractor(v))
+	}
+	return r
+}
+
+func newLocalStorage(c flagSource) (*fanbox.LocalStorage, error) {
+	t, err := newPathTemplate(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fanbox.LocalStorage{
+		SaveDir:      c.String(saveDirFlag.Name),
+		DirByPost:    c.Bool(dirByPostFlag.Name),
+		DirByPlan:    c.Bool(dirByPlanFlag.Name),
+		PathTemplate: t,
+
+		OriginalFileNames:      c.Bool(originalFileNamesFlag.Name),
+		RemoveUnprintableChars: c.Bool(removeUnprintableCharsFlag.Name),
+	}, nil
 }
 
 func main() {
@@ -255,8 +669,13 @@ func main() {
 		slog.Error("fanbox-dl Error", "error", err)
 		slog.Error("The error log seems a bug, please open an issue on GitHub", "url", "https://github.com/hareku/fanbox-dl/issues")
 
-		if errors.Is(err, fanbox.ErrStatusForbidden) {
+		switch {
+		case errors.Is(err, fanbox.ErrUnauthorized):
+			slog.Error("The session seems expired. Please update FANBOXSESSID or the cookie.")
+		case errors.Is(err, fanbox.ErrStatusForbidden):
 			slog.Error("This 403 error may occur when connecting from an IP address outside of Japan. Please try again from VPN or other IP addresses in Japan.")
+		case errors.Is(err, fanbox.ErrTooManyRequests):
+			slog.Error("FANBOX limits requests. Please wait for a while, and try again with smaller --api-rps.")
 		}
 		os.Exit(1)
 	}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemovePartFiles(t *testing.T) {
+	newClient := func(t *testing.T, dir string, dryRun bool) *fanbox.Client {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "img1.jpeg.part"), []byte("partial"), 0664))
+		return &fanbox.Client{DryRun: dryRun, Storage: &fanbox.LocalStorage{SaveDir: dir}}
+	}
+
+	shared, creator, dryRun := t.TempDir(), t.TempDir(), t.TempDir()
+	clients := []*fanbox.Client{
+		newClient(t, shared, false),
+		newClient(t, shared, false),
+		newClient(t, creator, false),
+		newClient(t, dryRun, true),
+	}
+	require.NoError(t, removePartFiles(context.Background(), clients))
+
+	assert.NoFileExists(t, filepath.Join(shared, "img1.jpeg.part"))
+	assert.NoFileExists(t, filepath.Join(creator, "img1.jpeg.part"))
+	assert.FileExists(t, filepath.Join(dryRun, "img1.jpeg.part"), "dry run should leave partial files")
+}
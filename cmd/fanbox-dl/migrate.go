@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+)
+
+var fromLayoutFlag = &cli.StringFlag{
+	Name:     "from-layout",
+	Required: true,
+	Usage:    "Current layout, a preset name (" + strings.Join(fanbox.PathTemplatePresetNames(), ", ") + ") or a path template.",
+}
+
+var toLayoutFlag = &cli.StringFlag{
+	Name:     "to-layout",
+	Required: true,
+	Usage:    "New layout, a preset name (" + strings.Join(fanbox.PathTemplatePresetNames(), ", ") + ") or a path template.",
+}
+
+var migrateCommand = &cli.Command{
+	Name:  "migrate",
+	Usage: "Move saved files in --save-dir from a layout to another layout.",
+	Flags: []cli.Flag{
+		configFlag,
+		saveDirFlag,
+		fromLayoutFlag,
+		toLayoutFlag,
+		postPathTemplateFlag,
+		originalFileNamesFlag,
+		removeUnprintableCharsFlag,
+		indexDBFlag,
+		sessIDFlag,
+		cookieFlag,
+		cookieFileFlag,
+		userAgentFlag,
+		apiRPSFlag,
+		downloadRPSFlag,
+		dryRunFlag,
+		verboseFlag,
+		logFormatFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if _, err := applyConfig(c); err != nil {
+			return err
+		}
+		if err := initLogger(c, os.Stdout); err != nil {
+			return err
+		}
+
+		fromTmpl, err := fanbox.NewPathTemplate(c.String(fromLayoutFlag.Name), "")
+		if err != nil {
+			return fmt.Errorf("--%s: %w", fromLayoutFlag.Name, err)
+		}
+		toTmpl, err := fanbox.NewPathTemplate(c.String(toLayoutFlag.Name), c.String(postPathTemplateFlag.Name))
+		if err != nil {
+			return fmt.Errorf("--%s: %w", toLayoutFlag.Name, err)
+		}
+
+		api, err := newAPIClient(c)
+		if err != nil {
+			return err
+		}
+		client := &fanbox.Client{OfficialAPIClient: api}
+
+		m := &fanbox.Migrator{
+			From: &fanbox.LocalStorage{
+				SaveDir:                c.String(saveDirFlag.Name),
+				PathTemplate:           fromTmpl,
+				RemoveUnprintableChars: c.Bool(removeUnprintableCharsFlag.Name),
+			},
+			To: &fanbox.LocalStorage{
+				SaveDir:                c.String(saveDirFlag.Name),
+				PathTemplate:           toTmpl,
+				OriginalFileNames:      c.Bool(originalFileNamesFlag.Name),
+				RemoveUnprintableChars: c.Bool(removeUnprintableCharsFlag.Name),
+			},
+			GetPost:   client.GetPost,
+			ListPosts: client.ListPosts,
+			DryRun:    c.Bool(dryRunFlag.Name),
+		}
+		if v := c.String(indexDBFlag.Name); v != "" {
+			idx, err := fanbox.OpenSQLiteIndex(c.Context, v)
+			if err != nil {
+				return fmt.Errorf("open download index: %w", err)
+			}
+			defer func() {
+				_ = idx.Close()
+			}()
+			m.Index = idx
+		}
+
+		ctx := c.Context
+		startedAt := time.Now()
+
+		res, err := m.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+
+		msg := "Moved"
+		if m.DryRun {
+			msg = "Will move"
+		}
+		for _, mv := range res.Moves {
+			slog.InfoContext(ctx, msg, "from", mv.From, "to", mv.To)
+		}
+		for _, cf := range res.Conflicts {
+			slog.WarnContext(ctx, "Conflict", "from", cf.From, "to", cf.To, "reason", cf.Reason)
+		}
+		for _, p := range res.Unresolved {
+			slog.WarnContext(ctx, "Post of the file is unknown, it is not moved", "path", p)
+		}
+
+		slog.InfoContext(ctx, "Completed.",
+			"moves", len(res.Moves),
+			"conflicts", len(res.Conflicts),
+			"unresolved", len(res.Unresolved),
+			"duration", time.Since(startedAt).Round(time.Millisecond*100),
+		)
+		if len(res.Conflicts) > 0 {
+			return cli.Exit("", 1)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/hareku/fanbox-dl/internal/cookie"
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+)
+
+var skipSessionCheckFlag = &cli.BoolFlag{
+	Name:  "skip-session-check",
+	Value: false,
+	Usage: "Whether to skip checking that the session is logged in before downloading.",
+}
+
+var whoamiCommand = &cli.Command{
+	Name:  "whoami",
+	Usage: "Show the user of the session and the number of supporting plans.",
+	Flags: []cli.Flag{
+		configFlag,
+		sessIDFlag,
+		cookieFlag,
+		cookieFileFlag,
+		userAgentFlag,
+		apiRPSFlag,
+		downloadRPSFlag,
+		outputFlag,
+		verboseFlag,
+		logFormatFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if err := initListing(c); err != nil {
+			return err
+		}
+		api, err := newAPIClient(c)
+		if err != nil {
+			return err
+		}
+
+		user, err := api.GetSessionUser(c.Context)
+		if err != nil {
+			return fmt.Errorf("get the user of the session: %w", err)
+		}
+		out := struct {
+			*fanbox.SessionUser
+			SupportingPlans int `json:"supportingPlans"`
+		}{SessionUser: user}
+		if user.IsLoggedIn {
+			plans, err := api.ListSupportingPlans(c.Context)
+			if err != nil {
+				return fmt.Errorf("list supporting plans: %w", err)
+			}
+			out.SupportingPlans = len(plans)
+		}
+
+		if err := writeOutput(c, out, []string{"LOGGED IN", "USER ID", "NAME", "SUPPORTING PLANS"}, [][]string{
+			{strconv.FormatBool(user.IsLoggedIn), user.UserID, user.Name, strconv.Itoa(out.SupportingPlans)},
+		}); err != nil {
+			return err
+		}
+		if !user.IsLoggedIn {
+			return cli.Exit("", 1)
+		}
+		return nil
+	},
+}
+
+// checkSession reports the user of the session, and fails if the session is set but it is not logged in,
+// so that an expired session doesn't silently download only free posts.
+// Failures of the check itself are only warned, not to stop downloading by changes of the page.
+func checkSession(ctx context.Context, api *fanbox.OfficialAPIClient) error {
+	if api.Cookie == "" {
+		slog.WarnContext(ctx, "The session is not set, only free posts are downloaded")
+		return nil
+	}
+
+	user, err := api.GetSessionUser(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to check the session, continue downloading", "error", err)
+		return nil
+	}
+	if !user.IsLoggedIn {
+		return fmt.Errorf("the session is not logged in, FANBOXSESSID or the cookie may be expired (use --%s to download anyway): %w",
+			skipSessionCheckFlag.Name, fanbox.ErrUnauthorized)
+	}
+	slog.InfoContext(ctx, "Logged in", "user_id", user.UserID, "name", user.Name)
+	return nil
+}
+
+// readCookieFile reads the cookie file and composes Cookie header of fanbox.cc.
+func readCookieFile(name string) (string, error) {
+	all, err := cookie.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	cookies := cookie.Filter(all, "fanbox.cc", time.Now())
+	if len(cookies) == 0 {
+		return "", fmt.Errorf("no cookies of fanbox.cc in %s (%d cookies of other domains or expired)", name, len(all))
+	}
+
+	hasSessID := false
+	for _, c := range cookies {
+		hasSessID = hasSessID || c.Name == "FANBOXSESSID"
+	}
+	if !hasSessID {
+		slog.Warn("FANBOXSESSID is not found in the cookie file, the session may not be logged in", "file", name)
+	}
+	slog.Debug("Using cookie file", "file", name, "cookies", len(cookies))
+	return cookie.Header(cookies), nil
+}
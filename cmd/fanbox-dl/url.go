@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+)
+
+var urlFlag = &cli.StringFlag{
+	Name:  "url",
+	Usage: "Comma separated post URLs to download only them, such as https://creator.fanbox.cc/posts/123. Creators are not listed if this is set.",
+}
+var urlFileFlag = &cli.StringFlag{
+	Name:  "url-file",
+	Usage: "File of post URLs to download only them, one URL per line. Empty lines and lines starting with '#' are ignored.",
+}
+
+// readPostURLs returns posts of --url and --url-file.
+func readPostURLs(c *cli.Context) ([]fanbox.PostRef, error) {
+	inputs := splitList(c.String(urlFlag.Name))
+	if name := c.String(urlFileFlag.Name); name != "" {
+		lines, err := readURLFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", urlFileFlag.Name, err)
+		}
+		inputs = append(inputs, lines...)
+	}
+
+	var (
+		refs []fanbox.PostRef
+		errs []error
+	)
+	for _, in := range inputs {
+		ref, err := fanbox.ParsePostURL(in)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid post URLs: %w", errors.Join(errs...))
+	}
+	return refs, nil
+}
+
+func readURLFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var res []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	return res, nil
+}
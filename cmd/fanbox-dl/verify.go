@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hareku/fanbox-dl/pkg/fanbox"
+	"github.com/urfave/cli/v2"
+)
+
+var refetchFlag = &cli.BoolFlag{
+	Name:  "refetch",
+	Value: false,
+	Usage: "Whether to download missing, truncated or corrupted assets again.",
+}
+
+var verifyCommand = &cli.Command{
+	Name:  "verify",
+	Usage: "Re-hash assets recorded in the download index, and report missing, truncated or corrupted ones. Only assets downloaded with --index-db are verified.",
+	Flags: []cli.Flag{
+		configFlag,
+		saveDirFlag,
+		indexDBFlag,
+		refetchFlag,
+		sessIDFlag,
+		cookieFlag,
+		cookieFileFlag,
+		userAgentFlag,
+		apiRPSFlag,
+		downloadRPSFlag,
+		dirByPostFlag,
+		dirByPlanFlag,
+		pathTemplateFlag,
+		postPathTemplateFlag,
+		originalFileNamesFlag,
+		removeUnprintableCharsFlag,
+		downloadEmbedsFlag,
+		ytDlpFlag,
+		verboseFlag,
+		logFormatFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if _, err := applyConfig(c); err != nil {
+			return err
+		}
+		if err := initLogger(c, os.Stdout); err != nil {
+			return err
+		}
+		if c.String(indexDBFlag.Name) == "" {
+			return fmt.Errorf("--%s is required", indexDBFlag.Name)
+		}
+
+		idx, err := fanbox.OpenSQLiteIndex(c.Context, c.String(indexDBFlag.Name))
+		if err != nil {
+			return fmt.Errorf("open download index: %w", err)
+		}
+		defer func() {
+			_ = idx.Close()
+		}()
+
+		ctx := c.Context
+		startedAt := time.Now()
+
+		issues, checked, err := fanbox.Verify(ctx, idx, c.String(saveDirFlag.Name))
+		if err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+		for _, issue := range issues {
+			slog.WarnContext(ctx, "Found a problem", "problem", issue.Problem, "root", issue.Entry.Root, "path", issue.Entry.Path, "post_id", issue.Entry.PostID, "asset_id", issue.Entry.AssetID)
+		}
+
+		remaining := len(issues)
+		if c.Bool(refetchFlag.Name) && len(issues) > 0 {
+			api, err := newAPIClient(c)
+			if err != nil {
+				return err
+			}
+			storage, err := newLocalStorage(c)
+			if err != nil {
+				return err
+			}
+			// assets are refetched into the roots which they were saved into, such as save dirs of creators
+			clients := make(map[string]*fanbox.Client)
+			clientOf := func(root string) *fanbox.Client {
+				if client, ok := clients[root]; ok {
+					return client
+				}
+				s := *storage
+				s.SaveDir = root
+				client := &fanbox.Client{
+					OfficialAPIClient: api,
+					Storage:           &s,
+					Index:             idx,
+					Extractors:        newExtractors(c),
+				}
+				clients[root] = client
+				return client
+			}
+			for _, issue := range issues {
+				// Verify reports only assets saved into the local file system
+				root, _ := issue.Entry.LocalRoot(c.String(saveDirFlag.Name))
+				loc, err := clientOf(root).Refetch(ctx, issue.Entry)
+				if err != nil {
+					slog.ErrorContext(ctx, "Failed to refetch", "path", issue.Entry.Path, "error", err)
+					continue
+				}
+				remaining--
+
+				// the layout was changed since the asset was recorded, don't leave the broken file
+				if loc != issue.Entry.Path && issue.Problem != fanbox.VerifyMissing {
+					old := filepath.Join(root, filepath.FromSlash(issue.Entry.Path))
+					if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+						slog.ErrorContext(ctx, "Failed to remove the broken file", "path", issue.Entry.Path, "error", err)
+					} else {
+						slog.InfoContext(ctx, "Removed the broken file, the asset is saved into the current layout", "path", issue.Entry.Path, "new_path", loc)
+					}
+				}
+			}
+		}
+
+		slog.InfoContext(ctx, "Completed.", "checked", checked, "problems", len(issues), "remaining_problems", remaining, "duration", time.Since(startedAt).Round(time.Millisecond*100))
+		if remaining > 0 {
+			return cli.Exit("", 1)
+		}
+		return nil
+	},
+}
@@ -1,22 +1,57 @@
 package applog
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 )
 
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options are options of the logger.
+type Options struct {
+	// Writer is the destination of logs, os.Stdout is used if it is nil.
+	Writer  io.Writer
+	Verbose bool
+	// Format is FormatText or FormatJSON, FormatText is used if it is empty.
+	Format string
+}
+
 func InitLogger(verbose bool) {
+	_ = InitLoggerWithOptions(Options{Verbose: verbose})
+}
+
+// InitLoggerWithOptions initializes the default logger.
+func InitLoggerWithOptions(o Options) error {
 	level := slog.LevelInfo
-	if verbose {
+	if o.Verbose {
 		level = slog.LevelDebug
 	}
+	w := o.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	opts := &slog.HandlerOptions{
+		Level: level,
+	}
 
 	var h slog.Handler
-	h = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: level,
-	})
+	switch o.Format {
+	case FormatText, "":
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format: %q", o.Format)
+	}
 	h = NewContextValueLogHandler(h)
 
 	logger := slog.New(h)
 	slog.SetDefault(logger)
+	return nil
 }
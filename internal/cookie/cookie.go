@@ -0,0 +1,67 @@
+// Package cookie reads cookies exported from browsers.
+package cookie
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// ReadFile reads cookies from the file, whose format is detected by its content:
+// a Firefox cookies.sqlite (or the profile directory which has it),
+// a JSON export of browser extensions, or a Netscape cookie file used by curl and wget.
+func ReadFile(name string) ([]*http.Cookie, error) {
+	if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+		name = filepath.Join(name, "cookies.sqlite")
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read cookie file: %w", err)
+	}
+
+	switch trimmed := bytes.TrimSpace(b); {
+	case bytes.HasPrefix(b, sqliteHeader):
+		return readFirefox(name)
+	case bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")):
+		return parseJSON(trimmed)
+	default:
+		return parseNetscape(b)
+	}
+}
+
+// Filter returns cookies of the domain and its subdomains which are not expired.
+func Filter(cookies []*http.Cookie, domain string, now time.Time) []*http.Cookie {
+	var res []*http.Cookie
+	for _, c := range cookies {
+		d := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+		if d != domain && !strings.HasSuffix(d, "."+domain) {
+			continue
+		}
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// Header composes the value of Cookie header, the first cookie is used if names are duplicated.
+func Header(cookies []*http.Cookie) string {
+	seen := make(map[string]bool, len(cookies))
+	pairs := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		if seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
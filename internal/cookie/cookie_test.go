@@ -0,0 +1,113 @@
+package cookie
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func names(cookies []*http.Cookie) []string {
+	res := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		res = append(res, c.Name)
+	}
+	return res
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, []byte(content), 0664))
+	return p
+}
+
+func TestReadFile_Netscape(t *testing.T) {
+	p := writeFile(t, "cookies.txt", "# Netscape HTTP Cookie File\n"+
+		"\n"+
+		"#HttpOnly_.fanbox.cc\tTRUE\t/\tTRUE\t1893456000\tFANBOXSESSID\tsess\r\n"+
+		"www.fanbox.cc\tFALSE\t/\tFALSE\t0\tp_ab_id\t1\n"+
+		".pixiv.net\tTRUE\t/\tTRUE\t1893456000\tPHPSESSID\tpixiv\n")
+
+	cookies, err := ReadFile(p)
+	require.NoError(t, err)
+	require.Len(t, cookies, 3)
+	require.Equal(t, &http.Cookie{
+		Domain: ".fanbox.cc", Path: "/", Secure: true, HttpOnly: true,
+		Name: "FANBOXSESSID", Value: "sess", Expires: time.Unix(1893456000, 0),
+	}, cookies[0])
+	require.True(t, cookies[1].Expires.IsZero(), "0 expiry is a session cookie")
+
+	_, err = ReadFile(writeFile(t, "invalid.txt", "fanbox.cc\tTRUE\t/\n"))
+	require.ErrorContains(t, err, "line 1")
+}
+
+func TestReadFile_JSON(t *testing.T) {
+	t.Run("array", func(t *testing.T) {
+		p := writeFile(t, "cookies.json", `[
+			{"domain": ".fanbox.cc", "name": "FANBOXSESSID", "value": "sess", "path": "/", "secure": true, "httpOnly": true, "expirationDate": 1893456000.5},
+			{"domain": "www.fanbox.cc", "name": "session", "value": "1", "session": true}
+		]`)
+		cookies, err := ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, []string{"FANBOXSESSID", "session"}, names(cookies))
+		require.Equal(t, time.Unix(1893456000, 5e8), cookies[0].Expires)
+		require.True(t, cookies[1].Expires.IsZero())
+	})
+
+	t.Run("object", func(t *testing.T) {
+		p := writeFile(t, "cookies.json", `{"cookies": [{"domain": "fanbox.cc", "name": "a", "value": "1", "expires": "2030-01-01T00:00:00Z"}]}`)
+		cookies, err := ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a"}, names(cookies))
+		require.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), cookies[0].Expires)
+	})
+}
+
+func TestReadFile_Firefox(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "cookies.sqlite"))
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE moz_cookies (id INTEGER PRIMARY KEY, name TEXT, value TEXT, host TEXT, path TEXT, expiry INTEGER, isSecure INTEGER, isHttpOnly INTEGER)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO moz_cookies (name, value, host, path, expiry, isSecure, isHttpOnly) VALUES
+		('FANBOXSESSID', 'sess', '.fanbox.cc', '/', 1893456000000, 1, 1),
+		('PHPSESSID', 'pixiv', '.pixiv.net', '/', 1893456000, 1, 0)`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// the profile directory is also accepted
+	cookies, err := ReadFile(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"FANBOXSESSID", "PHPSESSID"}, names(cookies))
+	require.Equal(t, time.Unix(1893456000, 0), cookies[0].Expires, "milliseconds expiry")
+	require.True(t, cookies[0].Secure)
+	require.True(t, cookies[0].HttpOnly)
+	require.Equal(t, time.Unix(1893456000, 0), cookies[1].Expires)
+}
+
+func TestFilter(t *testing.T) {
+	cookies := []*http.Cookie{
+		{Name: "a", Domain: ".fanbox.cc"},
+		{Name: "b", Domain: "www.fanbox.cc", Expires: now.Add(time.Hour)},
+		{Name: "expired", Domain: "fanbox.cc", Expires: now.Add(-time.Hour)},
+		{Name: "other", Domain: ".pixiv.net"},
+		{Name: "suffix", Domain: "notfanbox.cc"},
+	}
+	require.Equal(t, []string{"a", "b"}, names(Filter(cookies, "fanbox.cc", now)))
+}
+
+func TestHeader(t *testing.T) {
+	require.Equal(t, "FANBOXSESSID=sess; a=1", Header([]*http.Cookie{
+		{Name: "FANBOXSESSID", Value: "sess"},
+		{Name: "a", Value: "1"},
+		{Name: "a", Value: "2"},
+	}))
+	require.Equal(t, "", Header(nil))
+}
@@ -0,0 +1,93 @@
+package cookie
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // register "sqlite" driver
+)
+
+// readFirefox reads moz_cookies of Firefox cookies.sqlite.
+// The database is copied with its WAL file, because it is locked while Firefox is running
+// and recent cookies may be only in the WAL file.
+func readFirefox(name string) ([]*http.Cookie, error) {
+	dir, err := os.MkdirTemp("", "fanbox-dl-cookies-")
+	if err != nil {
+		return nil, fmt.Errorf("create a temporary directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	tmp := filepath.Join(dir, "cookies.sqlite")
+	if err := copyFile(name, tmp); err != nil {
+		return nil, err
+	}
+	if err := copyFile(name+"-wal", tmp+"-wal"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", tmp)
+	if err != nil {
+		return nil, fmt.Errorf("open cookie database: %w", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rows, err := db.Query(`SELECT host, name, value, path, expiry, isSecure, isHttpOnly FROM moz_cookies`)
+	if err != nil {
+		return nil, fmt.Errorf("query cookies: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var res []*http.Cookie
+	for rows.Next() {
+		var (
+			c      http.Cookie
+			expiry int64
+		)
+		if err := rows.Scan(&c.Domain, &c.Name, &c.Value, &c.Path, &expiry, &c.Secure, &c.HttpOnly); err != nil {
+			return nil, fmt.Errorf("scan a cookie: %w", err)
+		}
+		// recent versions store milliseconds
+		if expiry > 1e12 {
+			expiry /= 1000
+		}
+		if expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+		}
+		res = append(res, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate cookies: %w", err)
+	}
+	return res, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,74 @@
+package cookie
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// jsonCookie is a cookie exported by browser extensions, such as EditThisCookie and Cookie-Editor.
+type jsonCookie struct {
+	Domain         string  `json:"domain"`
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	HTTPOnly       bool    `json:"httpOnly"`
+	ExpirationDate float64 `json:"expirationDate"`
+	// Expires is used by some extensions instead of ExpirationDate.
+	Expires any `json:"expires"`
+}
+
+// parseJSON parses an array of cookies, or an object which has it in "cookies".
+func parseJSON(b []byte) ([]*http.Cookie, error) {
+	var items []jsonCookie
+	if b[0] == '{' {
+		var obj struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return nil, fmt.Errorf("parse JSON cookies: %w", err)
+		}
+		items = obj.Cookies
+	} else if err := json.Unmarshal(b, &items); err != nil {
+		return nil, fmt.Errorf("parse JSON cookies: %w", err)
+	}
+
+	res := make([]*http.Cookie, 0, len(items))
+	for _, item := range items {
+		c := &http.Cookie{
+			Domain:   item.Domain,
+			Name:     item.Name,
+			Value:    item.Value,
+			Path:     item.Path,
+			Secure:   item.Secure,
+			HttpOnly: item.HTTPOnly,
+		}
+		switch {
+		case item.ExpirationDate > 0:
+			sec, frac := math.Modf(item.ExpirationDate)
+			c.Expires = time.Unix(int64(sec), int64(frac*1e9))
+		case item.Expires != nil:
+			c.Expires = parseJSONExpires(item.Expires)
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// parseJSONExpires parses seconds or a RFC 3339 date time, it returns zero for session cookies.
+func parseJSONExpires(v any) time.Time {
+	switch v := v.(type) {
+	case float64:
+		if v > 0 {
+			return time.Unix(int64(v), 0)
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
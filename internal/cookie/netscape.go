@@ -0,0 +1,56 @@
+package cookie
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseNetscape parses the Netscape cookie file, whose lines are
+// "domain, include subdomains, path, secure, expiry, name, value" separated by tabs.
+func parseNetscape(b []byte) ([]*http.Cookie, error) {
+	var res []*http.Cookie
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		httpOnly := false
+		if v, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = v, true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: want 7 fields separated by tabs but got %d", n, len(fields))
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry %q", n, fields[4])
+		}
+
+		c := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		// 0 is a session cookie
+		if expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+		}
+		res = append(res, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read cookie file: %w", err)
+	}
+	return res, nil
+}
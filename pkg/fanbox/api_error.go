@@ -0,0 +1,87 @@
+package fanbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// apiErrorBodyLimit is the maximum bytes of the response body kept in APIError.
+const apiErrorBodyLimit = 512
+
+// Sentinel errors of response statuses, APIError wraps one of them.
+var (
+	// ErrUnauthorized means the session is expired or not set.
+	ErrUnauthorized = errors.New("status code 401")
+	// ErrStatusForbidden often means the request is from outside of Japan, or the plan isn't supported.
+	ErrStatusForbidden = errors.New("status code 403")
+	// ErrNotFound means the creator, post or asset doesn't exist, or it has been deleted.
+	ErrNotFound = errors.New("status code 404")
+	// ErrTooManyRequests means the requests are rate limited.
+	ErrTooManyRequests = errors.New("status code 429")
+	// ErrServerError means the server failed with a 5xx status.
+	ErrServerError = errors.New("server error")
+)
+
+// ErrCreatorNotFound is returned when posts of the creator can't be listed since the creator doesn't exist.
+// Unlike ErrNotFound, it isn't returned for deleted posts and assets.
+var ErrCreatorNotFound = errors.New("creator is not found")
+
+// APIError is the error of an unexpected response status.
+type APIError struct {
+	StatusCode int
+	// Endpoint is the requested URL without the query.
+	Endpoint string
+	// Body is the excerpt of the response body.
+	Body string
+}
+
+// newAPIError reads the excerpt of the response body, and returns the error of the response.
+func newAPIError(resp *http.Response) *APIError {
+	e := &APIError{StatusCode: resp.StatusCode}
+	if resp.Request != nil && resp.Request.URL != nil {
+		u := *resp.Request.URL
+		u.RawQuery, u.Fragment = "", ""
+		e.Endpoint = u.String()
+	}
+	if resp.Body != nil {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, apiErrorBodyLimit))
+		// not to cut a multibyte character in the middle
+		for len(b) > 0 && !utf8.Valid(b) {
+			b = b[:len(b)-1]
+		}
+		e.Body = strings.TrimSpace(string(b))
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Endpoint != "" {
+		msg += " from " + e.Endpoint
+	}
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error of the status, such as ErrNotFound.
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrStatusForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case e.StatusCode >= 500:
+		return ErrServerError
+	}
+	return nil
+}
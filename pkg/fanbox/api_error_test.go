@@ -0,0 +1,79 @@
+package fanbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{status: http.StatusUnauthorized, want: ErrUnauthorized},
+		{status: http.StatusForbidden, want: ErrStatusForbidden},
+		{status: http.StatusNotFound, want: ErrNotFound},
+		{status: http.StatusTooManyRequests, want: ErrTooManyRequests},
+		{status: http.StatusBadGateway, want: ErrServerError},
+		{status: http.StatusBadRequest, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &APIError{StatusCode: tt.status})
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+			}
+			for _, other := range []error{ErrUnauthorized, ErrStatusForbidden, ErrNotFound, ErrTooManyRequests, ErrServerError} {
+				if other != tt.want {
+					assert.NotErrorIs(t, err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestOfficialAPIClient_RequestAndUnwrapJSON_APIError(t *testing.T) {
+	api := newFakeAPIClient(t, fakeAPI{})
+
+	var v PostInfoResponse
+	err := api.RequestAndUnwrapJSON(context.Background(), http.MethodGet, "https://api.fanbox.cc/post.info?postId=1", &v)
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &APIError{
+		StatusCode: http.StatusNotFound,
+		Endpoint:   "https://api.fanbox.cc/post.info",
+		Body:       `{"error":"general_error"}`,
+	}, apiErr)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNewAPIError_BodyExcerpt(t *testing.T) {
+	body := strings.Repeat("あ", apiErrorBodyLimit)
+	e := newAPIError(&http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody})
+	assert.Empty(t, e.Body)
+
+	e = newAPIError(&http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader(body))})
+	assert.LessOrEqual(t, len(e.Body), apiErrorBodyLimit)
+	assert.True(t, strings.HasPrefix(body, e.Body))
+	assert.Equal(t, "status 500 Internal Server Error: "+e.Body, e.Error())
+}
+
+func TestClient_shouldSkip(t *testing.T) {
+	c := &Client{}
+	assert.True(t, c.shouldSkip(&APIError{StatusCode: http.StatusNotFound}))
+	assert.False(t, c.shouldSkip(&APIError{StatusCode: http.StatusForbidden}))
+
+	c.SkipOnError = true
+	assert.True(t, c.shouldSkip(&APIError{StatusCode: http.StatusForbidden}))
+	assert.False(t, c.shouldSkip(fmt.Errorf("download: %w", &APIError{StatusCode: http.StatusUnauthorized})))
+}
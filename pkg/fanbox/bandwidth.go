@@ -0,0 +1,190 @@
+package fanbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// minBandwidthBurst is the minimum bytes read at once from throttled bodies.
+const minBandwidthBurst = 4 << 10
+
+// BandwidthRule is the rate of a time range of the day, in the local time zone.
+type BandwidthRule struct {
+	// Start and End are durations since midnight, the range wraps midnight if Start is after End.
+	Start, End time.Duration
+	// BytesPerSecond is the rate, not positive means unlimited.
+	BytesPerSecond int64
+}
+
+func (r BandwidthRule) contains(d time.Duration) bool {
+	if r.Start <= r.End {
+		return r.Start <= d && d < r.End
+	}
+	return r.Start <= d || d < r.End
+}
+
+// BandwidthLimiter caps bytes per second of download bodies, shared by concurrent downloads.
+// The rate can vary by the time of the day.
+type BandwidthLimiter struct {
+	// Rules are matched in order, and DefaultBytesPerSecond is used if none of them match.
+	Rules []BandwidthRule
+	// DefaultBytesPerSecond is the default rate, not positive means unlimited.
+	DefaultBytesPerSecond int64
+
+	once    sync.Once
+	limiter *rate.Limiter
+	mu      sync.Mutex
+	current int64
+	now     func() time.Time
+}
+
+// ParseBandwidthLimit parses the rate such as "2M", or the comma separated schedule of rates by time ranges
+// such as "09:00-18:00=1M,22:00-06:00=0,4M", where a rate without a time range is the default.
+// Rates are bytes per second with optional K, M and G suffixes of 1024 multiples, and 0 means unlimited.
+func ParseBandwidthLimit(s string) (*BandwidthLimiter, error) {
+	l := &BandwidthLimiter{}
+	hasDefault := false
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		rangePart, ratePart, ok := strings.Cut(part, "=")
+		if !ok {
+			if hasDefault {
+				return nil, fmt.Errorf("multiple default rates in %q", s)
+			}
+			bps, err := parseByteRate(part)
+			if err != nil {
+				return nil, err
+			}
+			l.DefaultBytesPerSecond = bps
+			hasDefault = true
+			continue
+		}
+
+		startPart, endPart, ok := strings.Cut(rangePart, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time range %q, it should be like 09:00-18:00", rangePart)
+		}
+		var (
+			r   BandwidthRule
+			err error
+		)
+		if r.Start, err = parseTimeOfDay(startPart); err != nil {
+			return nil, err
+		}
+		if r.End, err = parseTimeOfDay(endPart); err != nil {
+			return nil, err
+		}
+		if r.BytesPerSecond, err = parseByteRate(ratePart); err != nil {
+			return nil, err
+		}
+		l.Rules = append(l.Rules, r)
+	}
+	return l, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, it should be like 09:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseByteRate(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	num := strings.TrimSuffix(s, "B")
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(num, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(num, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(num, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		num = num[:len(num)-1]
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid rate %q, it should be like 2M", s)
+	}
+	return int64(v * mult), nil
+}
+
+// rateAt returns bytes per second at the time.
+func (l *BandwidthLimiter) rateAt(t time.Time) int64 {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	d := t.Sub(midnight)
+	for _, r := range l.Rules {
+		if r.contains(d) {
+			return r.BytesPerSecond
+		}
+	}
+	return l.DefaultBytesPerSecond
+}
+
+// update applies the rate of now to the token bucket.
+func (l *BandwidthLimiter) update() *rate.Limiter {
+	l.once.Do(func() {
+		l.limiter = rate.NewLimiter(rate.Inf, 0)
+		l.current = -1
+		if l.now == nil {
+			l.now = time.Now
+		}
+	})
+
+	bps := l.rateAt(l.now())
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bps != l.current {
+		l.current = bps
+		if bps <= 0 {
+			l.limiter.SetLimit(rate.Inf)
+		} else {
+			l.limiter.SetLimit(rate.Limit(bps))
+			l.limiter.SetBurst(int(max(bps, minBandwidthBurst)))
+		}
+	}
+	return l.limiter
+}
+
+// Reader returns the reader which is throttled by the limiter.
+func (l *BandwidthLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, l: l}
+}
+
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *BandwidthLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	lim := t.l.update()
+	if lim.Limit() != rate.Inf && len(p) > lim.Burst() {
+		p = p[:lim.Burst()]
+	}
+
+	n, err := t.r.Read(p)
+	// the burst may get smaller by the schedule while reading, so wait by chunks of it
+	for rest := n; rest > 0 && lim.Limit() != rate.Inf; {
+		chunk := min(rest, lim.Burst())
+		if werr := lim.WaitN(t.ctx, chunk); werr != nil {
+			return n, werr
+		}
+		rest -= chunk
+	}
+	return n, err
+}
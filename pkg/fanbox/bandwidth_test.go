@@ -0,0 +1,86 @@
+package fanbox
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBandwidthLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *BandwidthLimiter
+		wantErr bool
+	}{
+		{in: "2M", want: &BandwidthLimiter{DefaultBytesPerSecond: 2 << 20}},
+		{in: "1.5k", want: &BandwidthLimiter{DefaultBytesPerSecond: 1536}},
+		{in: "1000", want: &BandwidthLimiter{DefaultBytesPerSecond: 1000}},
+		{in: "1GB", want: &BandwidthLimiter{DefaultBytesPerSecond: 1 << 30}},
+		{
+			in: "09:00-18:00=1M, 22:00-06:00=0, 4M",
+			want: &BandwidthLimiter{
+				Rules: []BandwidthRule{
+					{Start: 9 * time.Hour, End: 18 * time.Hour, BytesPerSecond: 1 << 20},
+					{Start: 22 * time.Hour, End: 6 * time.Hour, BytesPerSecond: 0},
+				},
+				DefaultBytesPerSecond: 4 << 20,
+			},
+		},
+		{in: "", wantErr: true},
+		{in: "fast", wantErr: true},
+		{in: "-1M", wantErr: true},
+		{in: "1M,2M", wantErr: true},
+		{in: "09:00=1M", wantErr: true},
+		{in: "9-18=1M", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBandwidthLimit(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBandwidthLimiter_rateAt(t *testing.T) {
+	l, err := ParseBandwidthLimit("09:00-18:00=1M,22:00-06:00=0,4M")
+	require.NoError(t, err)
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 1, 1, hour, min, 0, 0, time.Local)
+	}
+	assert.Equal(t, int64(1<<20), l.rateAt(at(9, 0)))
+	assert.Equal(t, int64(1<<20), l.rateAt(at(17, 59)))
+	assert.Equal(t, int64(4<<20), l.rateAt(at(18, 0)))
+	assert.Equal(t, int64(0), l.rateAt(at(23, 0)))
+	assert.Equal(t, int64(0), l.rateAt(at(5, 59)))
+	assert.Equal(t, int64(4<<20), l.rateAt(at(6, 0)))
+}
+
+func TestBandwidthLimiter_Reader(t *testing.T) {
+	l := &BandwidthLimiter{DefaultBytesPerSecond: 100 << 10}
+	content := bytes.Repeat([]byte("a"), 150<<10)
+
+	// two readers share the bandwidth, the burst of 100KiB is read at once and the rest takes 0.5s
+	start := time.Now()
+	b1, err := io.ReadAll(l.Reader(context.Background(), bytes.NewReader(content[:75<<10])))
+	require.NoError(t, err)
+	b2, err := io.ReadAll(l.Reader(context.Background(), bytes.NewReader(content[75<<10:])))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	assert.Equal(t, content, append(b1, b2...))
+
+	// nil doesn't throttle
+	var nl *BandwidthLimiter
+	r := bytes.NewReader(content)
+	assert.Equal(t, r, nl.Reader(context.Background(), r))
+}
@@ -1,72 +1,218 @@
 package fanbox
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/hareku/fanbox-dl/internal/ctxval"
 	"golang.org/x/net/http2"
+	"golang.org/x/sync/errgroup"
 )
 
 // Client is the struct for Client.
 type Client struct {
-	CheckAllPosts     bool
-	DryRun            bool
-	SkipFiles         bool
-	SkipImages        bool
-	SkipOnError       bool
+	CheckAllPosts bool
+	DryRun        bool
+	SkipFiles     bool
+	SkipImages    bool
+	SkipOnError   bool
+	// Concurrency is the maximum number of assets of a post downloaded at the same time.
+	// If it is less than 1, assets are downloaded one by one.
+	Concurrency       int
 	OfficialAPIClient *OfficialAPIClient
-	Storage           *LocalStorage
+	Storage           Storage
+	// SavePostMetadata is whether to save post.json of each post, if Storage implements PostDocumentStorage.
+	SavePostMetadata bool
+	// RenderPosts is whether to render posts into Markdown and HTML with links to saved assets,
+	// if Storage implements PostDocumentStorage.
+	RenderPosts bool
+	// Index is optional, if it is set, it is consulted before Storage and downloaded assets are recorded.
+	Index DownloadIndex
+	// Extractors is optional, if it is set, embeds supported by the extractors are downloaded.
+	Extractors *ExtractorRegistry
+	// Filter is optional, if it is set, only posts matched by it are downloaded.
+	Filter *PostFilter
+	// Bandwidth is optional, if it is set, download bodies are throttled by it.
+	// It should be shared by clients to cap the total bandwidth.
+	Bandwidth *BandwidthLimiter
 }
 
 func (c *Client) Run(ctx context.Context, creatorID string) error {
+	_, err := c.RunWithSummary(ctx, creatorID)
+	return err
+}
+
+// RunWithSummary downloads assets of the creator like Run, and returns the summary of the run.
+// The summary is returned even if the run fails, with the error in it.
+func (c *Client) RunWithSummary(ctx context.Context, creatorID string) (*RunSummary, error) {
+	rc := &runCounters{}
+	err := c.run(withRunCounters(ctx, rc), creatorID)
+	s := rc.summary(creatorID)
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s, err
+}
+
+// errCreatorMismatch is returned when the post given to RunPosts is not of the creator.
+var errCreatorMismatch = errors.New("creator of the post is different")
+
+// RunPosts downloads assets of the posts by their IDs, without listing posts of the creator.
+// The creator ID is used for logs and the summary, and posts of other creators are errors.
+// Unlike Run, Filter is not applied.
+func (c *Client) RunPosts(ctx context.Context, creatorID string, postIDs []string) (*RunSummary, error) {
+	rc := &runCounters{}
+	err := c.runPosts(withRunCounters(ctx, rc), creatorID, postIDs)
+	s := rc.summary(creatorID)
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s, err
+}
+
+func (c *Client) runPosts(ctx context.Context, creatorID string, postIDs []string) error {
 	ctx = ctxval.AddSlogAttrs(ctx, slog.String("creator_id", creatorID))
+	counters := countersFrom(ctx)
 
-	var pagination Pagination
-	if err := c.OfficialAPIClient.RequestAndUnwrapJSON(
-		ctx, http.MethodGet,
-		fmt.Sprintf("https://api.fanbox.cc/post.paginateCreator?%s", func() string {
-			q := url.Values{}
-			q.Set("creatorId", creatorID)
-			return q.Encode()
-		}()),
-		&pagination,
-	); err != nil {
-		return fmt.Errorf("get pagination: %w", err)
+	for _, id := range postIDs {
+		post, err := c.GetPost(ctxval.AddSlogAttrs(ctx, slog.String("post_id", id)), id)
+		if err == nil && !strings.EqualFold(post.CreatorID, creatorID) {
+			// the URL is mistyped, don't save the post as the creator's one
+			err = fmt.Errorf("%w: the post is of %q", errCreatorMismatch, post.CreatorID)
+		}
+		if err != nil {
+			// deleted posts are skipped like listed posts
+			if !c.shouldSkip(err) {
+				return fmt.Errorf("post %s: %w", id, err)
+			}
+			slog.ErrorContext(ctx, "Skip the post due to error", "post_id", id, "error", err)
+			counters.errors.Add(1)
+			continue
+		}
+		pctx := ctxval.AddSlogAttrs(ctx, slog.String("title", post.Title), slog.String("published_at", post.PublishedDateTime))
+
+		counters.postsScanned.Add(1)
+		if post.IsRestricted {
+			slog.WarnContext(pctx, "Skipping restricted post, its plan is not supported", "post_id", id, "fee", post.FeeRequired)
+			counters.restrictedPostsSkipped.Add(1)
+			continue
+		}
+		// already downloaded assets are not a reason to stop, because posts are given explicitly
+		if err := c.downloadPost(pctx, post, true); err != nil {
+			return fmt.Errorf("handle post %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) run(ctx context.Context, creatorID string) error {
+	ctx = ctxval.AddSlogAttrs(ctx, slog.String("creator_id", creatorID))
+
+	pages, err := c.paginate(ctx, creatorID)
+	if err != nil {
+		return err
 	}
-	slog.DebugContext(ctx, "Found pages", "pages", len(pagination.Pages))
 
-	for i, page := range pagination.Pages {
-		content := ListCreatorResponse{}
-		err := c.OfficialAPIClient.RequestAndUnwrapJSON(ctx, http.MethodGet, page, &content)
+	for i, page := range pages {
+		content, err := c.listPage(ctx, creatorID, page)
 		if err != nil {
-			return fmt.Errorf("list posts of %q: %w", creatorID, err)
+			return err
 		}
 		slog.DebugContext(ctx, "Found posts",
 			"page", i+1,
 			"posts", len(content.Body),
 		)
 
-		if err := c.handlePage(ctx, &content); err != nil {
+		if err := c.handlePage(ctx, content); err != nil {
 			if errors.Is(err, errAlreadyDownloaded) {
 				slog.DebugContext(ctx, "No more new assets")
 				return nil
 			}
+			if errors.Is(err, errPastSince) {
+				slog.DebugContext(ctx, "No more posts in the date range")
+				return nil
+			}
 			return fmt.Errorf("handle page: %w", err)
 		}
 	}
 	return nil
 }
 
+// ListPosts lists posts of the creator from the latest, bodies of posts are not included.
+func (c *Client) ListPosts(ctx context.Context, creatorID string) ([]Post, error) {
+	pages, err := c.paginate(ctx, creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Post
+	for _, page := range pages {
+		content, err := c.listPage(ctx, creatorID, page)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, content.Body...)
+	}
+	return res, nil
+}
+
+// paginate returns URLs of the pages of posts of the creator.
+func (c *Client) paginate(ctx context.Context, creatorID string) ([]string, error) {
+	var pagination Pagination
+	if err := c.OfficialAPIClient.RequestAndUnwrapJSON(
+		ctx, http.MethodGet,
+		fmt.Sprintf("https://api.fanbox.cc/post.paginateCreator?%s", func() string {
+			q := url.Values{}
+			q.Set("creatorId", creatorID)
+			return q.Encode()
+		}()),
+		&pagination,
+	); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("get pagination: %w: %w", ErrCreatorNotFound, err)
+		}
+		return nil, fmt.Errorf("get pagination: %w", err)
+	}
+	slog.DebugContext(ctx, "Found pages", "pages", len(pagination.Pages))
+	return pagination.Pages, nil
+}
+
+func (c *Client) listPage(ctx context.Context, creatorID string, page string) (*ListCreatorResponse, error) {
+	content := ListCreatorResponse{}
+	if err := c.OfficialAPIClient.RequestAndUnwrapJSON(ctx, http.MethodGet, page, &content); err != nil {
+		return nil, fmt.Errorf("list posts of %q: %w", creatorID, err)
+	}
+	return &content, nil
+}
+
+// errPastSince is returned when listed posts get older than Filter.Since.
+var errPastSince = errors.New("past the since date")
+
 func (c *Client) handlePage(ctx context.Context, content *ListCreatorResponse) error {
 	for _, item := range content.Body {
+		if !c.Filter.Match(item) {
+			// pinned posts are listed first regardless of their published date time
+			if c.Filter.isBeforeSince(item) && !item.IsPinned {
+				return errPastSince
+			}
+			slog.DebugContext(ctx, "Skipping filtered post", "post_id", item.ID, "title", item.Title)
+			continue
+		}
 		if err := c.handlePost(ctx, item); err != nil {
 			// pinned posts are maybe not latest, we should check next posts
 			if errors.Is(err, errAlreadyDownloaded) && item.IsPinned {
@@ -81,84 +227,342 @@ func (c *Client) handlePage(ctx context.Context, content *ListCreatorResponse) e
 func (c *Client) handlePost(ctx context.Context, item Post) error {
 	ctx = ctxval.AddSlogAttrs(ctx, slog.String("title", item.Title), slog.String("published_at", item.PublishedDateTime))
 
+	counters := countersFrom(ctx)
+	counters.postsScanned.Add(1)
 	if item.IsRestricted {
 		slog.DebugContext(ctx, "Skipping restricted post")
+		counters.restrictedPostsSkipped.Add(1)
 		return nil
 	}
 
+	post, err := c.GetPost(ctx, item.ID)
+	if err != nil {
+		if !c.shouldSkip(err) {
+			return err
+		}
+		slog.ErrorContext(ctx, "Skip the post due to error", "error", err)
+		counters.errors.Add(1)
+		return nil
+	}
+	return c.downloadPost(ctx, post, c.CheckAllPosts)
+}
+
+// shouldSkip reports whether the error of a post or an asset is skipped instead of aborting the run.
+// An expired session aborts the run since following requests fail too,
+// and deleted posts and assets are always skipped.
+func (c *Client) shouldSkip(err error) bool {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return false
+	case errors.Is(err, ErrNotFound):
+		return true
+	}
+	return c.SkipOnError
+}
+
+// downloadPost downloads assets of the post got by GetPost.
+// Unless checkAll, it stops at an already downloaded asset and returns errAlreadyDownloaded.
+func (c *Client) downloadPost(ctx context.Context, post Post, checkAll bool) error {
+	counters := countersFrom(ctx)
+	if !post.IsKnownType() {
+		slog.WarnContext(ctx, "Unknown post type, its content may not be downloaded. Please open an issue on GitHub", "type", post.Type)
+	}
+
+	if err := c.savePostMetadata(ctx, post); err != nil {
+		if !c.SkipOnError {
+			return fmt.Errorf("save post metadata: %w", err)
+		}
+		slog.ErrorContext(ctx, "Skip saving post metadata due to error", "error", err)
+		counters.errors.Add(1)
+	}
+	if err := c.renderPost(ctx, post); err != nil {
+		if !c.SkipOnError {
+			return fmt.Errorf("render post: %w", err)
+		}
+		slog.ErrorContext(ctx, "Skip rendering post due to error", "error", err)
+		counters.errors.Add(1)
+	}
+
+	assets, err := c.ListPostAssets(post)
+	if err != nil {
+		return err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.concurrency())
+
+	var alreadyDownloaded atomic.Bool
+	for i, a := range assets {
+		g.Go(func() error {
+			// stop at the first already downloaded asset as downloading one by one does,
+			// only assets being downloaded concurrently are completed
+			if alreadyDownloaded.Load() && !checkAll {
+				return nil
+			}
+			if err := c.handleAsset(
+				ctxval.AddSlogAttrs(gctx, slog.Int("i", i), slog.String("asset_type", a.Type)),
+				post, a.Order, a.Downloadable,
+			); err != nil {
+				if errors.Is(err, errAlreadyDownloaded) {
+					alreadyDownloaded.Store(true)
+					return nil
+				}
+				return fmt.Errorf("handle %s: %w", a.Type, err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	if alreadyDownloaded.Load() && !checkAll {
+		return errAlreadyDownloaded
+	}
+	return nil
+}
+
+// postMetadata is the content of post.json.
+type postMetadata struct {
+	URL string `json:"url"`
+	Post
+}
+
+func (c *Client) savePostMetadata(ctx context.Context, post Post) error {
+	ds, ok := c.Storage.(PostDocumentStorage)
+	if !ok || !c.SavePostMetadata || c.DryRun {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(postMetadata{URL: post.URL(), Post: post}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal post: %w", err)
+	}
+	slog.DebugContext(ctx, "Saving post metadata")
+	return ds.SavePostDocument(ctx, post, "post", "json", bytes.NewReader(b))
+}
+
+func (c *Client) renderPost(ctx context.Context, post Post) error {
+	ds, ok := c.Storage.(PostDocumentStorage)
+	if !ok || !c.RenderPosts || c.DryRun || len(post.contentBlocks()) == 0 {
+		return nil
+	}
+
+	assets, err := c.ListPostAssets(post)
+	if err != nil {
+		return err
+	}
+	locations := make(map[string]string, len(assets))
+	for _, a := range assets {
+		// skipped assets are not saved, link to FANBOX instead
+		if c.isSkippedType(a.Downloadable) {
+			continue
+		}
+		loc, err := c.Storage.Location(post, a.Order, a.Downloadable)
+		if err != nil {
+			// the asset can't be saved either, link to FANBOX instead
+			slog.WarnContext(ctx, "Linking the asset to FANBOX due to error", "asset_id", a.Downloadable.GetID(), "error", err)
+			continue
+		}
+		locations[a.Downloadable.GetID()] = loc
+	}
+
+	for _, doc := range []struct {
+		ext    string
+		render func(Post, assetLinker) string
+	}{
+		{ext: "md", render: renderPostMarkdown},
+		{ext: "html", render: renderPostHTML},
+	} {
+		docLoc, err := ds.PostDocumentLocation(post, "index", doc.ext)
+		if err != nil {
+			return err
+		}
+		docDir := path.Dir(docLoc)
+		link := func(d Downloadable) string {
+			if _, ok := locations[d.GetID()]; !ok {
+				return d.GetURL()
+			}
+			rel, err := filepath.Rel(filepath.FromSlash(docDir), filepath.FromSlash(locations[d.GetID()]))
+			if err != nil {
+				return locations[d.GetID()]
+			}
+			return filepath.ToSlash(rel)
+		}
+
+		slog.DebugContext(ctx, "Rendering post", "format", doc.ext)
+		if err := ds.SavePostDocument(ctx, post, "index", doc.ext, strings.NewReader(doc.render(post, link))); err != nil {
+			return fmt.Errorf("save %s: %w", doc.ext, err)
+		}
+	}
+	return nil
+}
+
+// GetPost gets the post with its body by post.info API.
+func (c *Client) GetPost(ctx context.Context, postID string) (Post, error) {
 	postResp := PostInfoResponse{}
 	if err := c.OfficialAPIClient.RequestAndUnwrapJSON(
 		ctx, http.MethodGet,
 		fmt.Sprintf("https://api.fanbox.cc/post.info?%s", func() string {
 			q := url.Values{}
-			q.Set("postId", item.ID)
+			q.Set("postId", postID)
 			return q.Encode()
 		}()),
 		&postResp,
 	); err != nil {
-		return fmt.Errorf("get post: %w", err)
+		return Post{}, fmt.Errorf("get post: %w", err)
+	}
+	return postResp.Body, nil
+}
+
+// Refetch downloads the recorded asset again, such as when it was found corrupted by Verify.
+// It returns the location where the asset is saved, which differs from the recorded path if the layout was changed.
+func (c *Client) Refetch(ctx context.Context, e IndexEntry) (string, error) {
+	if e.PostID == "" {
+		return "", fmt.Errorf("post of asset %s is unknown", e.AssetID)
+	}
+	ctx = ctxval.AddSlogAttrs(ctx, slog.String("post_id", e.PostID), slog.String("asset_id", e.AssetID))
+
+	post, err := c.GetPost(ctx, e.PostID)
+	if err != nil {
+		return "", err
+	}
+	assets, err := c.ListPostAssets(post)
+	if err != nil {
+		return "", err
 	}
-	post := postResp.Body
 
+	for _, a := range assets {
+		if a.Downloadable.GetID() != e.AssetID {
+			continue
+		}
+
+		d, err := c.resolveExtension(ctx, a.Downloadable)
+		if err != nil {
+			return "", err
+		}
+		slog.InfoContext(ctx, "Downloading")
+		if err := c.downloadWithRetry(ctx, post, a.Order, d); err != nil {
+			return "", fmt.Errorf("download: %w", err)
+		}
+		return c.Storage.Location(post, a.Order, d)
+	}
+	return "", fmt.Errorf("asset %s is not found in post %s", e.AssetID, e.PostID)
+}
+
+func (c *Client) concurrency() int {
+	if c.Concurrency < 1 {
+		return 1
+	}
+	return c.Concurrency
+}
+
+// PostAsset is a downloadable asset of a post.
+type PostAsset struct {
+	// Order is the order of the asset within its type in the post, which is used in file names.
+	Order int
+	// Type is "image", "file" or "embed".
+	Type         string
+	Downloadable Downloadable
+}
+
+// ListPostAssets returns the downloadable assets of the post with their orders.
+func (c *Client) ListPostAssets(post Post) ([]PostAsset, error) {
 	// for backward-compatibility, split downloadable file's order into two types
 	var (
-		nextImgOrder  int
-		nextFileOrder int
+		nextImgOrder   int
+		nextFileOrder  int
+		nextEmbedOrder int
 	)
-	for i, d := range post.ListDownloadable() {
-		var (
-			order     int
-			assetType string
-		)
-
+	downloadables := post.ListDownloadableWith(c.Extractors)
+	res := make([]PostAsset, 0, len(downloadables))
+	for _, d := range downloadables {
+		a := PostAsset{Downloadable: d}
 		switch d.(type) {
 		case Image:
-			assetType = "image"
-			order = nextImgOrder
+			a.Type = "image"
+			a.Order = nextImgOrder
 			nextImgOrder++
 		case File:
-			assetType = "file"
-			order = nextFileOrder
+			a.Type = "file"
+			a.Order = nextFileOrder
 			nextFileOrder++
+		case EmbeddedAsset:
+			a.Type = "embed"
+			a.Order = nextEmbedOrder
+			nextEmbedOrder++
 		default:
-			return fmt.Errorf("unsupported asset type: %+v", d)
-		}
-
-		if err := c.handleAsset(
-			ctxval.AddSlogAttrs(ctx, slog.Int("i", i), slog.String("asset_type", assetType)),
-			post, order, d,
-		); err != nil {
-			if errors.Is(err, errAlreadyDownloaded) && c.CheckAllPosts {
-				continue
-			}
-			return fmt.Errorf("handle %s: %w", assetType, err)
+			return nil, fmt.Errorf("unsupported asset type: %+v", d)
 		}
+		res = append(res, a)
 	}
-
-	return nil
+	return res, nil
 }
 
 var errAlreadyDownloaded = errors.New("already downloaded")
 
-func (c *Client) handleAsset(ctx context.Context, post Post, order int, d Downloadable) error {
-	if _, ok := d.(File); ok && c.SkipFiles {
-		slog.DebugContext(ctx, "Skip downloading files")
-		return nil
+// isSkippedType reports whether the asset is not downloaded by SkipFiles or SkipImages.
+func (c *Client) isSkippedType(d Downloadable) bool {
+	switch d.(type) {
+	case File:
+		return c.SkipFiles
+	case Image:
+		return c.SkipImages
 	}
-	if _, ok := d.(Image); ok && c.SkipImages {
-		slog.DebugContext(ctx, "Skip downloading images")
+	return false
+}
+
+func (c *Client) handleAsset(ctx context.Context, post Post, order int, d Downloadable) error {
+	if c.isSkippedType(d) {
+		slog.DebugContext(ctx, "Skip downloading the asset type")
 		return nil
 	}
 
+	counters := countersFrom(ctx)
 	if d.GetID() == "" {
 		slog.DebugContext(ctx, "Asset ID is empty")
 		return nil
 	}
 
-	isDownloaded, err := c.Storage.Exist(post, order, d)
+	if c.Index != nil {
+		e, err := c.Index.Lookup(ctx, post.ID, d.GetID())
+		if err != nil {
+			if c.SkipOnError {
+				slog.ErrorContext(ctx, "Skip downloading due to error", "error", err)
+				counters.errors.Add(1)
+				return nil
+			}
+
+			return fmt.Errorf("look up download index: %w", err)
+		}
+		if e != nil {
+			slog.DebugContext(ctx, "Already downloaded", "path", e.Path)
+			counters.alreadyPresent.Add(1)
+			return errAlreadyDownloaded
+		}
+	}
+
+	// resolving the extension runs the extractor or requests the asset, which dry runs don't
+	if a, ok := d.(EmbeddedAsset); ok && a.Extension == "" && c.DryRun {
+		slog.InfoContext(ctx, "Skip downloading due to dry-run mode")
+		return nil
+	}
+
+	d, err := c.resolveExtension(ctx, d)
+	if err != nil {
+		if c.shouldSkip(err) {
+			slog.ErrorContext(ctx, "Skip downloading due to error", "error", err)
+			counters.errors.Add(1)
+			return nil
+		}
+		return err
+	}
+
+	isDownloaded, err := c.Storage.Exist(ctx, post, order, d)
 	if err != nil {
 		if c.SkipOnError {
 			slog.ErrorContext(ctx, "Skip downloading due to error", "error", err)
+			counters.errors.Add(1)
 			return nil
 		}
 
@@ -167,6 +571,7 @@ func (c *Client) handleAsset(ctx context.Context, post Post, order int, d Downlo
 
 	if isDownloaded {
 		slog.DebugContext(ctx, "Already downloaded")
+		counters.alreadyPresent.Add(1)
 		return errAlreadyDownloaded
 	}
 
@@ -177,8 +582,9 @@ func (c *Client) handleAsset(ctx context.Context, post Post, order int, d Downlo
 
 	slog.InfoContext(ctx, "Downloading")
 	if err := c.downloadWithRetry(ctx, post, order, d); err != nil {
-		if c.SkipOnError {
+		if c.shouldSkip(err) {
 			slog.ErrorContext(ctx, "Skip downloading due to error", "error", err)
+			counters.errors.Add(1)
 			return nil
 		}
 		return fmt.Errorf("download: %w", err)
@@ -187,9 +593,63 @@ func (c *Client) handleAsset(ctx context.Context, post Post, order int, d Downlo
 	return nil
 }
 
+// resolveExtension sets the extension of the embedded asset which is unknown until accessing it,
+// such as videos downloaded by yt-dlp and files shared by Google Drive.
+func (c *Client) resolveExtension(ctx context.Context, d Downloadable) (Downloadable, error) {
+	a, ok := d.(EmbeddedAsset)
+	if !ok || a.Extension != "" {
+		return d, nil
+	}
+
+	if r, ok := a.extractor.(ExtensionResolver); ok {
+		ext, err := r.ResolveExtension(ctx, a)
+		if err != nil {
+			return nil, fmt.Errorf("resolve extension of %s: %w", a.PageURL, err)
+		}
+		a.Extension = ext
+	} else if a.URL != "" {
+		ext, err := c.responseExtension(ctx, a.URL)
+		if err != nil {
+			return nil, fmt.Errorf("resolve extension of %s: %w", a.PageURL, err)
+		}
+		a.Extension = ext
+	} else {
+		a.Extension = "bin"
+	}
+	slog.DebugContext(ctx, "Resolved extension", "extension", a.Extension)
+	return a, nil
+}
+
+// responseExtension requests the first byte of the URL, and returns the extension of the file name
+// in Content-Disposition header, or "bin" if it is unknown.
+func (c *Client) responseExtension(ctx context.Context, u string) (string, error) {
+	resp, err := c.OfficialAPIClient.RequestWithHeader(ctx, http.MethodGet, u, http.Header{
+		"Range":           {"bytes=0-0"},
+		"Accept-Encoding": {"identity"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("request error (%s): %w", u, err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", newAPIError(resp)
+	}
+
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if ext, ok := normalizeExtension(path.Ext(params["filename"])); ok {
+			return ext, nil
+		}
+	}
+	return "bin", nil
+}
+
 func (c *Client) downloadWithRetry(ctx context.Context, post Post, order int, d Downloadable) error {
+	// 429 and 5xx responses are already retried by HTTPClient, only broken transfers are retried here
 	shouldRetry := func(err error) bool {
-		if errors.Is(err, io.ErrUnexpectedEOF) {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errPartialContentMismatch) {
 			return true
 		}
 
@@ -202,9 +662,10 @@ func (c *Client) downloadWithRetry(ctx context.Context, post Post, order int, d
 		return errors.As(err, &goAwayErr)
 	}
 
+	var err error
 	waitDur := time.Second
 	for retry := 0; retry < 10; retry++ {
-		if err := c.download(ctx, post, order, d); err != nil {
+		if err = c.download(ctx, post, order, d); err != nil {
 			if !shouldRetry(err) {
 				return fmt.Errorf("download error: %w", err)
 			}
@@ -217,50 +678,233 @@ func (c *Client) downloadWithRetry(ctx context.Context, post Post, order int, d
 			}
 			continue
 		}
-		break
+		return nil
 	}
-	return nil
+	return fmt.Errorf("download error after retries: %w", err)
 }
 
-var ErrStatusForbidden = errors.New("status code 403")
-
 func (c *Client) download(ctx context.Context, post Post, order int, d Downloadable) error {
-	var resp *http.Response
+	if a, ok := d.(EmbeddedAsset); ok && a.URL == "" {
+		return c.downloadStream(ctx, post, order, a)
+	}
 
-	resp, err := c.OfficialAPIClient.Request(ctx, http.MethodGet, d.GetURL())
-	if err != nil {
-		if errors.Is(err, ErrFailedToThumbnailing) {
-			slog.InfoContext(ctx, "The original file is not available (maybe it's a too large), so download a thumbnail instead", "original_file", d.GetURL())
-			tu, ok := d.GetThumbnailURL()
-			if !ok {
-				return fmt.Errorf("thumbnail URL is not found")
-			}
-			slog.InfoContext(ctx, "Downloading a thumbnail", "thumbnail_url", tu)
+	rs, ok := c.Storage.(ResumableStorage)
+	if !ok {
+		resp, sourceURL, err := c.requestAsset(ctx, d, nil)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}()
 
-			resp, err = c.OfficialAPIClient.Request(ctx, http.MethodGet, tu)
-			if err != nil {
-				return fmt.Errorf("request error (%s): %w", tu, err)
-			}
-		} else {
-			return fmt.Errorf("request error (%s): %w", d.GetURL(), err)
+		if resp.StatusCode != 200 {
+			return newAPIError(resp)
 		}
+
+		body := newHashingReader(c.Bandwidth.Reader(ctx, resp.Body), resp.ContentLength)
+		if err := c.Storage.Save(ctx, post, order, d, body); err != nil {
+			return fmt.Errorf("save a file: %w", err)
+		}
+		return c.record(ctx, post, order, d, sourceURL, body)
+	}
+
+	partial, err := rs.OpenPartial(ctx, post, order, d)
+	if err != nil {
+		return fmt.Errorf("open a partial file: %w", err)
+	}
+	defer func() {
+		_ = partial.Close()
+	}()
+
+	// byte offsets must be of the identity encoding to resume
+	header := http.Header{"Accept-Encoding": {"identity"}}
+	if partial.Size() > 0 && partial.Validator() != "" {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", partial.Size()))
+		header.Set("If-Range", partial.Validator())
 	}
 
+	resp, sourceURL, err := c.requestAsset(ctx, d, header)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		_, _ = io.Copy(io.Discard, resp.Body)
 		_ = resp.Body.Close()
 	}()
 
-	if resp.StatusCode != 200 {
-		if resp.StatusCode == 403 {
-			return ErrStatusForbidden
+	body := newHashingReader(c.Bandwidth.Reader(ctx, resp.Body), resp.ContentLength)
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != partial.Size() || (partial.Validator() != responseValidator(resp) && responseValidator(resp) != "") {
+			// the partial content can't be trusted anymore, download from scratch at the next retry
+			if err := partial.Reset(""); err != nil {
+				return fmt.Errorf("reset a partial file: %w", err)
+			}
+			return fmt.Errorf("unexpected partial content (%s): %w", resp.Header.Get("Content-Range"), errPartialContentMismatch)
+		}
+
+		slog.InfoContext(ctx, "Resuming download", "offset", start)
+		if err := body.seed(partial); err != nil {
+			return fmt.Errorf("read a partial file: %w", err)
+		}
+		body.wantSize = total
+	case http.StatusOK:
+		if partial.Size() > 0 {
+			slog.InfoContext(ctx, "The asset has been changed or doesn't support resuming, downloading from scratch")
+		}
+		if err := partial.Reset(responseValidator(resp)); err != nil {
+			return fmt.Errorf("reset a partial file: %w", err)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if err := partial.Reset(""); err != nil {
+			return fmt.Errorf("reset a partial file: %w", err)
+		}
+		return fmt.Errorf("range not satisfiable: %w", errPartialContentMismatch)
+	default:
+		return newAPIError(resp)
+	}
+
+	// the partial file is kept on errors to resume at the next retry or the next run
+	if _, err := io.Copy(partial, body); err != nil {
+		if errors.Is(err, errPartialContentMismatch) {
+			if err := partial.Reset(""); err != nil {
+				return fmt.Errorf("reset a partial file: %w", err)
+			}
 		}
-		return fmt.Errorf("status code %d", resp.StatusCode)
+		return fmt.Errorf("file copying error: %w", err)
+	}
+	if err := partial.Commit(); err != nil {
+		return fmt.Errorf("commit a partial file: %w", err)
+	}
+
+	return c.record(ctx, post, order, d, sourceURL, body)
+}
+
+// downloadStream downloads the embedded asset by its extractor, such as an external tool.
+func (c *Client) downloadStream(ctx context.Context, post Post, order int, a EmbeddedAsset) error {
+	se, ok := a.extractor.(StreamExtractor)
+	if !ok {
+		return fmt.Errorf("extractor of %s doesn't support downloading", a.PageURL)
 	}
 
-	if err := c.Storage.Save(post, order, d, resp.Body); err != nil {
+	rc, err := se.Open(ctx, a)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", a.PageURL, err)
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	body := newHashingReader(c.Bandwidth.Reader(ctx, rc), -1)
+	if err := c.Storage.Save(ctx, post, order, a, body); err != nil {
 		return fmt.Errorf("save a file: %w", err)
 	}
+	if err := rc.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", a.PageURL, err)
+	}
+	return c.record(ctx, post, order, a, a.PageURL, body)
+}
+
+// errPartialContentMismatch is returned when the partial file is discarded, downloading should be retried from scratch.
+var errPartialContentMismatch = errors.New("partial content mismatch")
+
+// requestAsset requests the asset, and falls back to the thumbnail if the original file is not available.
+// It returns the response and the requested URL.
+func (c *Client) requestAsset(ctx context.Context, d Downloadable, header http.Header) (*http.Response, string, error) {
+	resp, err := c.OfficialAPIClient.RequestWithHeader(ctx, http.MethodGet, d.GetURL(), header)
+	if err == nil {
+		return resp, d.GetURL(), nil
+	}
+	if !errors.Is(err, ErrFailedToThumbnailing) {
+		return nil, "", fmt.Errorf("request error (%s): %w", d.GetURL(), err)
+	}
+
+	slog.InfoContext(ctx, "The original file is not available (maybe it's a too large), so download a thumbnail instead", "original_file", d.GetURL())
+	tu, ok := d.GetThumbnailURL()
+	if !ok {
+		return nil, "", fmt.Errorf("thumbnail URL is not found")
+	}
+	slog.InfoContext(ctx, "Downloading a thumbnail", "thumbnail_url", tu)
 
+	resp, err = c.OfficialAPIClient.RequestWithHeader(ctx, http.MethodGet, tu, header)
+	if err != nil {
+		return nil, "", fmt.Errorf("request error (%s): %w", tu, err)
+	}
+	return resp, tu, nil
+}
+
+// record counts the downloaded asset, and records it to Index.
+func (c *Client) record(ctx context.Context, post Post, order int, d Downloadable, sourceURL string, body *hashingReader) error {
+	counters := countersFrom(ctx)
+	counters.assetsDownloaded.Add(1)
+	counters.bytesDownloaded.Add(body.size)
+
+	if c.Index == nil {
+		return nil
+	}
+
+	loc, err := c.Storage.Location(post, order, d)
+	if err != nil {
+		return err
+	}
+	var root string
+	if rs, ok := c.Storage.(RootedStorage); ok {
+		root = rs.Root()
+	}
+	if err := c.Index.Record(ctx, &IndexEntry{
+		PostID:    post.ID,
+		AssetID:   d.GetID(),
+		Path:      loc,
+		Root:      root,
+		Size:      body.size,
+		SHA256:    body.Sum(),
+		FetchedAt: time.Now(),
+		SourceURL: sourceURL,
+	}); err != nil {
+		return fmt.Errorf("record to download index: %w", err)
+	}
 	return nil
 }
+
+// responseValidator returns the validator for If-Range header.
+// Weak ETags can't be used for If-Range, so Last-Modified is used instead.
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange parses Content-Range header such as "bytes 100-199/200".
+// total is -1 if the complete length is unknown.
+func parseContentRange(v string) (start int64, total int64, err error) {
+	rangeSpec, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("unsupported unit: %q", v)
+	}
+	rangePart, totalPart, ok := strings.Cut(rangeSpec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid content range: %q", v)
+	}
+	startPart, _, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid content range: %q", v)
+	}
+
+	start, err = strconv.ParseInt(startPart, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parse range start: %w", err)
+	}
+	if totalPart == "*" {
+		return start, -1, nil
+	}
+	total, err = strconv.ParseInt(totalPart, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parse complete length: %w", err)
+	}
+	return start, total, nil
+}
@@ -0,0 +1,302 @@
+package fanbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyFileServer serves the content with Range support,
+// and drops the connection in the middle of the body of the first dropCount requests.
+type flakyFileServer struct {
+	content   []byte
+	etag      string
+	dropCount int
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (s *flakyFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	drop := len(s.requests) <= s.dropCount
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", s.etag)
+	if drop {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(s.content[:len(s.content)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.content))
+}
+
+func newTestDownloadClient(t *testing.T) *Client {
+	t.Helper()
+
+	httpClient := retryablehttp.NewClient()
+	httpClient.Logger = nil
+	return &Client{
+		OfficialAPIClient: &OfficialAPIClient{HTTPClient: httpClient},
+		Storage:           &LocalStorage{SaveDir: t.TempDir(), DirByPost: true},
+	}
+}
+
+func TestClient_downloadWithRetry_Resume(t *testing.T) {
+	post := Post{
+		Title:             "title",
+		PublishedDateTime: "2022-03-15T12:00:00+09:00",
+		CreatorID:         "creator",
+	}
+
+	t.Run("dropped connection", func(t *testing.T) {
+		srv := &flakyFileServer{
+			content:   bytes.Repeat([]byte("0123456789"), 100000),
+			etag:      `"v1"`,
+			dropCount: 1,
+		}
+		ts := httptest.NewServer(srv)
+		t.Cleanup(ts.Close)
+
+		c := newTestDownloadClient(t)
+		f := File{ID: "file1", Extension: "zip", URL: ts.URL + "/file1.zip"}
+		require.NoError(t, c.downloadWithRetry(context.Background(), post, 0, f))
+
+		name, err := c.Storage.(*LocalStorage).makeFileName(post, 0, f)
+		require.NoError(t, err)
+		got, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, srv.content, got)
+
+		require.Len(t, srv.requests, 2)
+		assert.Equal(t, "bytes=500000-", srv.requests[1].Header.Get("Range"))
+		assert.Equal(t, `"v1"`, srv.requests[1].Header.Get("If-Range"))
+	})
+
+	t.Run("changed content", func(t *testing.T) {
+		srv := &flakyFileServer{
+			content: []byte("new content"),
+			etag:    `"v2"`,
+		}
+		ts := httptest.NewServer(srv)
+		t.Cleanup(ts.Close)
+
+		c := newTestDownloadClient(t)
+		f := File{ID: "file1", Extension: "zip", URL: ts.URL + "/file1.zip"}
+
+		// partial file which was downloaded from the old content
+		ls := c.Storage.(*LocalStorage)
+		name, err := ls.makeFileName(post, 0, f)
+		require.NoError(t, err)
+		partName := ls.makePartFileName(name, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(partName), 0775))
+		require.NoError(t, os.WriteFile(partName, []byte("old"), 0664))
+		require.NoError(t, os.WriteFile(partName+partValidatorSuffix, []byte(`"v1"`), 0664))
+
+		require.NoError(t, c.downloadWithRetry(context.Background(), post, 0, f))
+
+		got, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, "new content", string(got))
+
+		entries, err := os.ReadDir(filepath.Dir(partName))
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "partial files should be removed")
+		assert.False(t, strings.HasSuffix(entries[0].Name(), partFileSuffix))
+	})
+}
+
+func TestClient_Run_StopsAtDownloadedAsset(t *testing.T) {
+	ctx := context.Background()
+	api := fakeAPI{
+		"/post.paginateCreator?creatorId=creator": `{"body":["https://api.fanbox.cc/post.listCreator?creatorId=creator&limit=10"]}`,
+		"/post.listCreator?creatorId=creator&limit=10": `{"body":[
+			{"id":"1","title":"images","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator"}
+		]}`,
+		"/post.info?postId=1": `{"body":{"id":"1","title":"images","type":"image","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator",
+			"body":{"images":[
+				{"id":"img1","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img1.png"},
+				{"id":"img2","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img2.png"},
+				{"id":"img3","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img3.png"}
+			]}
+		}}`,
+		"/images/img1.png": "png1",
+		"/images/img3.png": "png3",
+	}
+
+	for _, tt := range []struct {
+		name          string
+		checkAllPosts bool
+		wantImg3      bool
+	}{
+		{name: "stop", checkAllPosts: false, wantImg3: false},
+		{name: "all", checkAllPosts: true, wantImg3: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &LocalStorage{SaveDir: t.TempDir()}
+			client := &Client{
+				CheckAllPosts:     tt.checkAllPosts,
+				OfficialAPIClient: newFakeAPIClient(t, api),
+				Storage:           storage,
+			}
+			post, err := client.GetPost(ctx, "1")
+			require.NoError(t, err)
+			images := post.ListDownloadable()
+			require.NoError(t, storage.Save(ctx, post, 1, images[1], strings.NewReader("png2")))
+
+			require.NoError(t, client.Run(ctx, "creator"))
+
+			for i, want := range []bool{true, true, tt.wantImg3} {
+				ok, err := storage.Exist(ctx, post, i, images[i])
+				require.NoError(t, err)
+				assert.Equal(t, want, ok, "image %d", i)
+			}
+		})
+	}
+}
+
+func TestClient_handleAsset_PathTemplateError(t *testing.T) {
+	post := Post{
+		ID:                "post1",
+		Title:             "ab",
+		PublishedDateTime: "2022-03-15T12:00:00+09:00",
+		CreatorID:         "creator",
+	}
+	tmpl, err := NewPathTemplate(`{{.CreatorID}}/{{slice .Title 0 3}}/{{.AssetID}}.{{.Extension}}`, "")
+	require.NoError(t, err)
+	img := Image{ID: "img1", Extension: "jpeg", OriginalURL: "https://downloads.fanbox.cc/images/img1.jpeg"}
+
+	for _, skipOnError := range []bool{false, true} {
+		c := newTestDownloadClient(t)
+		c.Storage = &LocalStorage{SaveDir: t.TempDir(), PathTemplate: tmpl}
+		c.SkipOnError = skipOnError
+
+		rc := &runCounters{}
+		err := c.handleAsset(withRunCounters(context.Background(), rc), post, 0, img)
+		if skipOnError {
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), rc.errors.Load())
+		} else {
+			assert.ErrorContains(t, err, "slice")
+		}
+	}
+}
+
+func TestClient_downloadWithRetry_ServerError(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(ts.Close)
+
+	c := newTestDownloadClient(t)
+	c.OfficialAPIClient.HTTPClient.RetryMax = 2
+	c.OfficialAPIClient.HTTPClient.RetryWaitMin = time.Millisecond
+	c.OfficialAPIClient.HTTPClient.RetryWaitMax = time.Millisecond
+	c.OfficialAPIClient.HTTPClient.ErrorHandler = retryablehttp.PassthroughErrorHandler
+
+	post := Post{Title: "title", PublishedDateTime: "2022-03-15T12:00:00+09:00", CreatorID: "creator"}
+	err := c.downloadWithRetry(context.Background(), post, 0, File{ID: "file1", Extension: "zip", URL: ts.URL + "/file1.zip"})
+	assert.ErrorIs(t, err, ErrServerError)
+	// retried only by HTTPClient
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+// existNotifyingStorage closes found when an asset is found in the storage.
+type existNotifyingStorage struct {
+	Storage
+	found chan struct{}
+	once  sync.Once
+}
+
+func (s *existNotifyingStorage) Exist(ctx context.Context, post Post, order int, d Downloadable) (bool, error) {
+	ok, err := s.Storage.Exist(ctx, post, order, d)
+	if ok {
+		s.once.Do(func() { close(s.found) })
+	}
+	return ok, err
+}
+
+func TestClient_downloadPost_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	var images []string
+	api := fakeAPI{}
+	for i := 1; i <= 6; i++ {
+		images = append(images, fmt.Sprintf(`{"id":"img%d","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img%d.png"}`, i, i))
+		api[fmt.Sprintf("/images/img%d.png", i)] = "png"
+	}
+	api["/post.info?postId=1"] = `{"body":{"id":"1","title":"images","type":"image","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator",
+		"body":{"images":[` + strings.Join(images, ",") + `]}}}`
+
+	// newClient returns a client whose first asset is already downloaded, and the paths it fetched
+	newClient := func(t *testing.T) (*Client, *sync.Map) {
+		storage := &existNotifyingStorage{Storage: &LocalStorage{SaveDir: t.TempDir()}, found: make(chan struct{})}
+		var fetched sync.Map
+		apiClient := newFakeAPIClient(t, api)
+		apiClient.HTTPClient.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.HasPrefix(req.URL.Path, "/images/") {
+				fetched.Store(req.URL.Path, true)
+				// let the present asset be found before the concurrent one completes
+				select {
+				case <-storage.found:
+				case <-time.After(time.Second):
+				}
+			}
+			return api.RoundTrip(req)
+		})
+		c := &Client{
+			Concurrency:       2,
+			OfficialAPIClient: apiClient,
+			Storage:           storage,
+		}
+
+		post, err := c.GetPost(ctx, "1")
+		require.NoError(t, err)
+		require.NoError(t, c.Storage.Save(ctx, post, 0, post.ListDownloadable()[0], strings.NewReader("png")))
+		return c, &fetched
+	}
+
+	t.Run("stops at downloaded asset", func(t *testing.T) {
+		c, fetched := newClient(t)
+		post, err := c.GetPost(ctx, "1")
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, c.downloadPost(ctx, post, false), errAlreadyDownloaded)
+		// img2 may be downloaded concurrently with img1, but no later asset is started
+		for i := 3; i <= 6; i++ {
+			_, ok := fetched.Load(fmt.Sprintf("/images/img%d.png", i))
+			assert.False(t, ok, "img%d should not be fetched", i)
+		}
+	})
+
+	t.Run("RunPosts downloads all assets", func(t *testing.T) {
+		c, fetched := newClient(t)
+
+		s, err := c.RunPosts(ctx, "creator", []string{"1"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), s.AssetsDownloaded)
+		assert.Equal(t, int64(1), s.AlreadyPresent)
+		for i := 2; i <= 6; i++ {
+			_, ok := fetched.Load(fmt.Sprintf("/images/img%d.png", i))
+			assert.True(t, ok, "img%d should be fetched", i)
+		}
+	})
+}
@@ -2,12 +2,17 @@ package fanbox
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 type CreatorIDListerDoInput struct {
+	// InputCreatorIDs and IgnoreCreatorIDs accept inputs supported by ParseCreatorInput,
+	// such as "@" prefixed creator IDs, pixiv user IDs and URLs of creator pages.
 	InputCreatorIDs   []string
 	IncludeSupporting bool
 	IncludeFollowing  bool
@@ -18,59 +23,154 @@ type CreatorIDLister struct {
 	OfficialAPIClient *OfficialAPIClient
 }
 
+// ListedCreator is a creator found by CreatorIDLister.
+type ListedCreator struct {
+	CreatorID string `json:"creatorId"`
+	// Sources are where the creator is found, "input", "supporting" or "following".
+	Sources []string `json:"sources"`
+	// SupportingPlan is the plan which the user supports, if the creator is found by "supporting".
+	SupportingPlan *Plan `json:"supportingPlan,omitempty"`
+}
+
 func (c *CreatorIDLister) Do(ctx context.Context, in *CreatorIDListerDoInput) ([]string, error) {
-	all, err := c.all(ctx, in)
+	creators, err := c.List(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(creators))
+	for _, cr := range creators {
+		res = append(res, cr.CreatorID)
+	}
+	return res, nil
+}
+
+// List lists creators with where they are found.
+func (c *CreatorIDLister) List(ctx context.Context, in *CreatorIDListerDoInput) ([]*ListedCreator, error) {
+	inputIDs, err := c.Resolve(ctx, in.InputCreatorIDs)
+	if err != nil {
+		return nil, fmt.Errorf("resolve creators: %w", err)
+	}
+	ignoreIDs, err := c.Resolve(ctx, in.IgnoreCreatorIDs)
+	if err != nil {
+		return nil, fmt.Errorf("resolve ignored creators: %w", err)
+	}
+
+	all, err := c.all(ctx, inputIDs, in)
 	if err != nil {
 		return nil, fmt.Errorf("list all creator IDs: %w", err)
 	}
 
 	ignoreMap := map[string]interface{}{}
-	for _, id := range in.IgnoreCreatorIDs {
+	for _, id := range ignoreIDs {
 		ignoreMap[id] = nil
 	}
-	res := make([]string, 0, len(all))
-	for _, id := range all {
-		if _, ok := ignoreMap[id]; ok {
+	res := make([]*ListedCreator, 0, len(all))
+	for _, cr := range all {
+		if _, ok := ignoreMap[cr.CreatorID]; ok {
 			continue
 		}
-		res = append(res, id)
+		res = append(res, cr)
 	}
 	return res, nil
 }
 
-func (c *CreatorIDLister) all(ctx context.Context, in *CreatorIDListerDoInput) ([]string, error) {
-	if len(in.InputCreatorIDs) > 0 {
-		slog.Debug("Use input creator IDs", "ids", in.InputCreatorIDs)
-		return in.InputCreatorIDs, nil
+// Resolve normalizes the inputs supported by ParseCreatorInput into creator IDs,
+// pixiv user IDs are resolved by creator.get API. The error lists all inputs which can't be resolved.
+// Bare digits are used as a creator ID if no creator has the pixiv user ID.
+func (c *CreatorIDLister) Resolve(ctx context.Context, inputs []string) ([]string, error) {
+	var (
+		res  []string
+		errs []error
+	)
+	seen := map[string]bool{}
+	for _, in := range inputs {
+		ref, err := ParseCreatorInput(in)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ref.PixivUserID != "" {
+			cr := CreatorGetResponse{}
+			if err := c.OfficialAPIClient.RequestAndUnwrapJSON(
+				ctx, http.MethodGet,
+				fmt.Sprintf("https://api.fanbox.cc/creator.get?%s", func() string {
+					q := url.Values{}
+					q.Set("userId", ref.PixivUserID)
+					return q.Encode()
+				}()),
+				&cr,
+			); err != nil && !errors.Is(err, ErrNotFound) {
+				errs = append(errs, fmt.Errorf("%q: get creator of pixiv user %s: %w", in, ref.PixivUserID, err))
+				continue
+			}
+			switch {
+			case cr.Body.CreatorID != "":
+				slog.DebugContext(ctx, "Resolved pixiv user ID", "user_id", ref.PixivUserID, "creator_id", cr.Body.CreatorID)
+				ref.CreatorID = cr.Body.CreatorID
+			case postIDPattern.MatchString(strings.TrimSpace(in)):
+				// bare digits may be a creator ID which consists of digits
+				slog.DebugContext(ctx, "No creator of the pixiv user ID, using it as a creator ID", "input", in)
+				ref.CreatorID = ref.PixivUserID
+			default:
+				errs = append(errs, fmt.Errorf("%q: pixiv user %s is not a FANBOX creator", in, ref.PixivUserID))
+				continue
+			}
+		}
+		if !seen[ref.CreatorID] {
+			seen[ref.CreatorID] = true
+			res = append(res, ref.CreatorID)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return res, nil
+}
+
+func (c *CreatorIDLister) all(ctx context.Context, inputIDs []string, in *CreatorIDListerDoInput) ([]*ListedCreator, error) {
+	if len(inputIDs) > 0 {
+		slog.Debug("Use input creator IDs", "ids", inputIDs)
+		res := make([]*ListedCreator, 0, len(inputIDs))
+		for _, id := range inputIDs {
+			res = append(res, &ListedCreator{CreatorID: id, Sources: []string{"input"}})
+		}
+		return res, nil
 	}
 
-	ids := map[string]interface{}{}
+	var res []*ListedCreator
+	creators := map[string]*ListedCreator{}
+	add := func(id string, source string) *ListedCreator {
+		cr, ok := creators[id]
+		if !ok {
+			cr = &ListedCreator{CreatorID: id}
+			creators[id] = cr
+			res = append(res, cr)
+		}
+		cr.Sources = append(cr.Sources, source)
+		return cr
+	}
 
 	if in.IncludeSupporting {
-		plans := PlanListSupportingResponse{}
-		err := c.OfficialAPIClient.RequestAndUnwrapJSON(ctx, http.MethodGet, "https://api.fanbox.cc/plan.listSupporting", &plans)
+		plans, err := c.OfficialAPIClient.ListSupportingPlans(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("list supporintg plans: %w", err)
 		}
-		for _, p := range plans.Body {
-			ids[p.CreatorID] = nil
+		for _, p := range plans {
+			add(p.CreatorID, "supporting").SupportingPlan = &p
 		}
 	}
 
 	if in.IncludeFollowing {
-		following := PlanListSupportingResponse{}
+		following := CreatorListFollowingResponse{}
 		err := c.OfficialAPIClient.RequestAndUnwrapJSON(ctx, http.MethodGet, "https://api.fanbox.cc/creator.listFollowing", &following)
 		if err != nil {
 			return nil, fmt.Errorf("list following creators: %w", err)
 		}
 		for _, f := range following.Body {
-			ids[f.CreatorID] = nil
+			add(f.CreatorID, "following")
 		}
 	}
 
-	res := make([]string, 0, len(ids))
-	for id := range ids {
-		res = append(res, id)
-	}
 	return res, nil
 }
@@ -0,0 +1,103 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPI responds to requests by the path and query, such as "/post.info?postId=1".
+type fakeAPI map[string]string
+
+func (f fakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.Path
+	if req.URL.RawQuery != "" {
+		key += "?" + req.URL.RawQuery
+	}
+	body, ok := f[key]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+		body = `{"error":"general_error"}`
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        http.StatusText(status),
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		Request:       req,
+	}, nil
+}
+
+func newFakeAPIClient(t *testing.T, api fakeAPI) *OfficialAPIClient {
+	t.Helper()
+
+	httpClient := retryablehttp.NewClient()
+	httpClient.Logger = nil
+	httpClient.RetryMax = 0
+	httpClient.HTTPClient.Transport = api
+	return &OfficialAPIClient{HTTPClient: httpClient}
+}
+
+func TestCreatorIDLister_List(t *testing.T) {
+	lister := &CreatorIDLister{OfficialAPIClient: newFakeAPIClient(t, fakeAPI{
+		"/plan.listSupporting": `{"body":[
+			{"id":"p1","title":"Basic","fee":500,"creatorId":"creator1"},
+			{"id":"p2","title":"Premium","fee":1000,"creatorId":"creator2"}
+		]}`,
+		"/creator.listFollowing": `{"body":[{"creatorId":"creator2"},{"creatorId":"creator3"}]}`,
+	})}
+
+	creators, err := lister.List(context.Background(), &CreatorIDListerDoInput{
+		IncludeSupporting: true,
+		IncludeFollowing:  true,
+		IgnoreCreatorIDs:  []string{"creator3"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*ListedCreator{
+		{CreatorID: "creator1", Sources: []string{"supporting"}, SupportingPlan: &Plan{ID: "p1", Title: "Basic", Fee: 500, CreatorID: "creator1"}},
+		{CreatorID: "creator2", Sources: []string{"supporting", "following"}, SupportingPlan: &Plan{ID: "p2", Title: "Premium", Fee: 1000, CreatorID: "creator2"}},
+	}, creators)
+
+	ids, err := lister.Do(context.Background(), &CreatorIDListerDoInput{InputCreatorIDs: []string{"creator4"}, IncludeSupporting: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"creator4"}, ids)
+}
+
+func TestCreatorIDLister_List_Inputs(t *testing.T) {
+	lister := &CreatorIDLister{OfficialAPIClient: newFakeAPIClient(t, fakeAPI{
+		"/creator.get?userId=111": `{"body":{"creatorId":"creator3","user":{"userId":"111","name":"Creator 3"}}}`,
+	})}
+
+	ids, err := lister.Do(context.Background(), &CreatorIDListerDoInput{
+		InputCreatorIDs:  []string{"creator1", "@creator2", "https://www.fanbox.cc/@creator1", "111", "https://creator4.fanbox.cc/"},
+		IgnoreCreatorIDs: []string{"https://creator4.fanbox.cc"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"creator1", "creator2", "creator3"}, ids)
+
+	_, err = lister.Do(context.Background(), &CreatorIDListerDoInput{
+		InputCreatorIDs: []string{"creator1", "https://example.com/", "https://www.pixiv.net/users/222"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"https://example.com/"`)
+	assert.Contains(t, err.Error(), `"https://www.pixiv.net/users/222"`)
+}
+
+func TestCreatorIDLister_Resolve_DigitsFallback(t *testing.T) {
+	lister := &CreatorIDLister{OfficialAPIClient: newFakeAPIClient(t, fakeAPI{
+		"/creator.get?userId=111": `{"body":{"creatorId":"creator3","user":{"userId":"111","name":"Creator 3"}}}`,
+	})}
+
+	// 222 is not a pixiv user ID of any creator, so it is a creator ID
+	ids, err := lister.Resolve(context.Background(), []string{"111", "222", "@333"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"creator3", "222", "333"}, ids)
+}
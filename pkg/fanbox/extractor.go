@@ -0,0 +1,300 @@
+package fanbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// EmbeddedAsset is a downloadable asset of an embedded URL, which is resolved by an Extractor.
+type EmbeddedAsset struct {
+	// ID is the embed ID of the block, or is made from the post ID for "video" posts.
+	ID string
+	// PageURL is the embedded URL.
+	PageURL string
+	// URL is the direct download URL, it is empty if the extractor downloads the asset by itself.
+	URL string
+	// Extension is empty if it is unknown until accessing the asset, it is resolved before downloading by
+	// ExtensionResolver of the extractor, or by Content-Disposition header of URL.
+	Extension string
+
+	extractor Extractor
+}
+
+func (a EmbeddedAsset) GetID() string {
+	return a.ID
+}
+
+func (a EmbeddedAsset) GetURL() string {
+	return a.URL
+}
+
+func (a EmbeddedAsset) GetThumbnailURL() (string, bool) {
+	return "", false
+}
+
+func (a EmbeddedAsset) GetExtension() string {
+	return a.Extension
+}
+
+// Extractor resolves embedded URLs into downloadable assets.
+type Extractor interface {
+	// Extract returns the asset of the URL, or false if the URL is not supported.
+	// ID of the returned asset is set by the caller.
+	Extract(pageURL *url.URL) (EmbeddedAsset, bool)
+}
+
+// StreamExtractor is implemented by extractors which download assets by themselves,
+// such as extractors invoking external tools.
+type StreamExtractor interface {
+	Extractor
+	// Open returns the content of the asset.
+	Open(ctx context.Context, a EmbeddedAsset) (io.ReadCloser, error)
+}
+
+// ExtensionResolver is implemented by extractors which know the file extension of the asset only by accessing it.
+type ExtensionResolver interface {
+	Extractor
+	// ResolveExtension returns the file extension of the asset whose Extension is empty.
+	ResolveExtension(ctx context.Context, a EmbeddedAsset) (string, error)
+}
+
+// ExtractorRegistry holds extractors, the first extractor which supports the URL is used.
+type ExtractorRegistry struct {
+	extractors []Extractor
+}
+
+// NewExtractorRegistry creates ExtractorRegistry with the built-in extractors for
+// FANBOX hosted videos and direct download hosts (Dropbox and Google Drive).
+func NewExtractorRegistry() *ExtractorRegistry {
+	r := &ExtractorRegistry{}
+	r.Register(FanboxVideoExtractor{}, DropboxExtractor{}, GoogleDriveExtractor{})
+	return r
+}
+
+// Register adds the extractors, they are used in the registered order.
+func (r *ExtractorRegistry) Register(extractors ...Extractor) {
+	r.extractors = append(r.extractors, extractors...)
+}
+
+// Extract returns the asset of the URL by the first extractor which supports it.
+func (r *ExtractorRegistry) Extract(id string, pageURL string) (EmbeddedAsset, bool) {
+	if r == nil || pageURL == "" {
+		return EmbeddedAsset{}, false
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return EmbeddedAsset{}, false
+	}
+
+	for _, e := range r.extractors {
+		if a, ok := e.Extract(u); ok {
+			a.ID = id
+			a.PageURL = pageURL
+			a.extractor = e
+			return a, true
+		}
+	}
+	return EmbeddedAsset{}, false
+}
+
+// urlExtension returns the file extension in the URL path, or "bin" if it is not found.
+func urlExtension(u *url.URL) string {
+	if ext, ok := normalizeExtension(path.Ext(u.Path)); ok {
+		return ext
+	}
+	return "bin"
+}
+
+var extensionRegexp = regexp.MustCompile(`^[0-9a-z]{1,16}$`)
+
+// normalizeExtension lowercases the extension without the leading dot,
+// and reports whether it can be used in file names parsed by parseAssetFileName.
+func normalizeExtension(ext string) (string, bool) {
+	ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+	return ext, extensionRegexp.MatchString(ext)
+}
+
+// FanboxVideoExtractor extracts video files uploaded to FANBOX.
+type FanboxVideoExtractor struct{}
+
+var fanboxVideoExtensions = map[string]bool{"mp4": true, "mov": true, "webm": true, "m4v": true}
+
+func (FanboxVideoExtractor) Extract(u *url.URL) (EmbeddedAsset, bool) {
+	if !isFanboxHost(u.Hostname()) || !fanboxVideoExtensions[urlExtension(u)] {
+		return EmbeddedAsset{}, false
+	}
+	return EmbeddedAsset{URL: u.String(), Extension: urlExtension(u)}, true
+}
+
+// DropboxExtractor extracts files shared by Dropbox links.
+type DropboxExtractor struct{}
+
+func (DropboxExtractor) Extract(u *url.URL) (EmbeddedAsset, bool) {
+	if u.Hostname() != "www.dropbox.com" && u.Hostname() != "dropbox.com" {
+		return EmbeddedAsset{}, false
+	}
+	if !strings.HasPrefix(u.Path, "/s/") && !strings.HasPrefix(u.Path, "/scl/fi/") {
+		return EmbeddedAsset{}, false
+	}
+
+	// dl=1 makes the link download the file directly
+	du := *u
+	q := du.Query()
+	q.Set("dl", "1")
+	du.RawQuery = q.Encode()
+	return EmbeddedAsset{URL: du.String(), Extension: urlExtension(u)}, true
+}
+
+// GoogleDriveExtractor extracts files shared by Google Drive links.
+type GoogleDriveExtractor struct{}
+
+var googleDriveFileRegexp = regexp.MustCompile(`^/file/d/([0-9A-Za-z_-]+)`)
+
+func (GoogleDriveExtractor) Extract(u *url.URL) (EmbeddedAsset, bool) {
+	if u.Hostname() != "drive.google.com" {
+		return EmbeddedAsset{}, false
+	}
+
+	id := u.Query().Get("id")
+	if m := googleDriveFileRegexp.FindStringSubmatch(u.Path); m != nil {
+		id = m[1]
+	}
+	if id == "" {
+		return EmbeddedAsset{}, false
+	}
+
+	q := url.Values{}
+	q.Set("id", id)
+	q.Set("export", "download")
+	q.Set("confirm", "t")
+	// the file name is unknown until downloading, the extension is resolved by Content-Disposition header
+	return EmbeddedAsset{URL: "https://drive.usercontent.google.com/download?" + q.Encode()}, true
+}
+
+// CommandExtractor invokes an external command which writes the content to stdout, such as yt-dlp.
+type CommandExtractor struct {
+	// Hosts are host names supported by the command.
+	Hosts []string
+	// Command is the path to the command.
+	Command string
+	// Args are arguments of the command, "{url}" is replaced with the embedded URL.
+	Args []string
+	// Extension is the file extension of the content, if it is empty, it is printed by the command with ExtensionArgs.
+	Extension string
+	// ExtensionArgs are arguments of the command to print the file extension of the content to stdout.
+	// "{url}" is replaced with the embedded URL. If both of Extension and ExtensionArgs are empty, "bin" is used.
+	ExtensionArgs []string
+}
+
+var _ ExtensionResolver = (*CommandExtractor)(nil)
+
+// NewYtDlpExtractor creates CommandExtractor which downloads YouTube, Vimeo and SoundCloud content by yt-dlp.
+// The extension is printed by yt-dlp, since the format falls back to a container other than mp4.
+func NewYtDlpExtractor(command string) *CommandExtractor {
+	format := "best[ext=mp4]/best"
+	return &CommandExtractor{
+		Hosts:         []string{"www.youtube.com", "youtube.com", "youtu.be", "vimeo.com", "soundcloud.com"},
+		Command:       command,
+		Args:          []string{"--quiet", "--no-playlist", "--format", format, "--output", "-", "{url}"},
+		ExtensionArgs: []string{"--quiet", "--no-playlist", "--format", format, "--print", "ext", "{url}"},
+	}
+}
+
+func (e *CommandExtractor) Extract(u *url.URL) (EmbeddedAsset, bool) {
+	for _, h := range e.Hosts {
+		if u.Hostname() == h {
+			return EmbeddedAsset{Extension: e.Extension}, true
+		}
+	}
+	return EmbeddedAsset{}, false
+}
+
+func (e *CommandExtractor) ResolveExtension(ctx context.Context, a EmbeddedAsset) (string, error) {
+	if e.Extension != "" {
+		return e.Extension, nil
+	}
+	if len(e.ExtensionArgs) == 0 {
+		return "bin", nil
+	}
+
+	cmd := exec.CommandContext(ctx, e.Command, commandArgs(e.ExtensionArgs, a)...)
+	stderr := &strings.Builder{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", e.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	ext, ok := normalizeExtension(string(out))
+	if !ok {
+		return "", fmt.Errorf("%s printed an invalid extension: %q", e.Command, string(out))
+	}
+	return ext, nil
+}
+
+// commandArgs replaces "{url}" in args with the embedded URL.
+func commandArgs(args []string, a EmbeddedAsset) []string {
+	res := make([]string, 0, len(args))
+	for _, arg := range args {
+		res = append(res, strings.ReplaceAll(arg, "{url}", a.PageURL))
+	}
+	return res
+}
+
+func (e *CommandExtractor) Open(ctx context.Context, a EmbeddedAsset) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, e.Command, commandArgs(e.Args, a)...)
+	stderr := &strings.Builder{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", e.Command, err)
+	}
+	return &commandOutput{cmd: cmd, stdout: stdout, stderr: stderr}, nil
+}
+
+// commandOutput reads stdout of the command, and fails at the end if the command failed,
+// so that storages don't save incomplete content.
+type commandOutput struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *strings.Builder
+	done   bool
+	err    error
+}
+
+func (o *commandOutput) Read(p []byte) (int, error) {
+	n, err := o.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		if werr := o.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (o *commandOutput) wait() error {
+	if !o.done {
+		o.done = true
+		if err := o.cmd.Wait(); err != nil {
+			o.err = fmt.Errorf("%s failed: %w: %s", o.cmd.Path, err, strings.TrimSpace(o.stderr.String()))
+		}
+	}
+	return o.err
+}
+
+func (o *commandOutput) Close() error {
+	if o.done {
+		return nil
+	}
+	_ = o.stdout.Close()
+	return o.wait()
+}
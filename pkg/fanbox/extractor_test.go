@@ -0,0 +1,190 @@
+package fanbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPost_ListDownloadableWith(t *testing.T) {
+	ytDlp := NewYtDlpExtractor("yt-dlp")
+	r := NewExtractorRegistry()
+	r.Register(ytDlp)
+
+	t.Run("article", func(t *testing.T) {
+		post := loadPostInfo(t, "post_info_article.json")
+
+		var embeds []EmbeddedAsset
+		for _, d := range post.ListDownloadableWith(r) {
+			if a, ok := d.(EmbeddedAsset); ok {
+				embeds = append(embeds, a)
+			}
+		}
+		assert.Equal(t, []EmbeddedAsset{
+			{
+				ID:        "embed1",
+				PageURL:   "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+				extractor: ytDlp,
+			},
+			{
+				ID:        "urlembed1",
+				PageURL:   "https://www.dropbox.com/s/abc/archive.zip?dl=0",
+				URL:       "https://www.dropbox.com/s/abc/archive.zip?dl=1",
+				Extension: "zip",
+				extractor: DropboxExtractor{},
+			},
+			{
+				ID:        "urlembed2",
+				PageURL:   "https://drive.google.com/file/d/DRIVEID/view?usp=sharing&x=1",
+				URL:       "https://drive.usercontent.google.com/download?confirm=t&export=download&id=DRIVEID",
+				extractor: GoogleDriveExtractor{},
+			},
+		}, embeds)
+	})
+
+	t.Run("video", func(t *testing.T) {
+		post := loadPostInfo(t, "post_info_video.json")
+		assert.Empty(t, post.ListDownloadableWith(NewExtractorRegistry()))
+		assert.Equal(t, []Downloadable{EmbeddedAsset{
+			ID:        "video1000003",
+			PageURL:   "https://vimeo.com/76979871",
+			extractor: ytDlp,
+		}}, post.ListDownloadableWith(r))
+	})
+
+	t.Run("without extractors", func(t *testing.T) {
+		post := loadPostInfo(t, "post_info_article.json")
+		assert.Equal(t, post.ListDownloadable(), post.ListDownloadableWith(nil))
+	})
+}
+
+func TestFanboxVideoExtractor(t *testing.T) {
+	r := &ExtractorRegistry{}
+	r.Register(FanboxVideoExtractor{})
+
+	a, ok := r.Extract("v1", "https://downloads.fanbox.cc/files/post/1000002/movie.MP4")
+	require.True(t, ok)
+	assert.Equal(t, "https://downloads.fanbox.cc/files/post/1000002/movie.MP4", a.URL)
+	assert.Equal(t, "mp4", a.Extension)
+
+	for _, u := range []string{
+		"https://downloads.fanbox.cc/files/post/1000002/archive.zip",
+		"https://example.com/movie.mp4",
+		"https://www.fanbox.cc/@creator/posts/1000001",
+	} {
+		_, ok := r.Extract("v1", u)
+		assert.False(t, ok, u)
+	}
+}
+
+func TestClient_resolveExtension(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("command", func(t *testing.T) {
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh is not found")
+		}
+		e := &CommandExtractor{Command: "sh", ExtensionArgs: []string{"-c", `echo "WEBM"`}}
+		d, err := (&Client{}).resolveExtension(ctx, EmbeddedAsset{ID: "e1", extractor: e})
+		require.NoError(t, err)
+		assert.Equal(t, "webm", d.GetExtension())
+
+		e.ExtensionArgs = []string{"-c", `echo "../mp4"`}
+		_, err = (&Client{}).resolveExtension(ctx, EmbeddedAsset{ID: "e1", extractor: e})
+		assert.Error(t, err)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh is not found")
+		}
+		marker := filepath.Join(t.TempDir(), "resolved")
+		e := &CommandExtractor{Command: "sh", ExtensionArgs: []string{"-c", `touch "$0" && echo mp4`, marker}}
+		c := &Client{DryRun: true, Storage: &LocalStorage{SaveDir: t.TempDir()}}
+
+		post := Post{ID: "1", Title: "title", PublishedDateTime: "2022-03-15T12:00:00+09:00", CreatorID: "creator"}
+		require.NoError(t, c.handleAsset(ctx, post, 0, EmbeddedAsset{ID: "e1", extractor: e}))
+		assert.NoFileExists(t, marker, "extractor should not run in dry runs")
+	})
+
+	t.Run("Content-Disposition", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "bytes=0-0", r.Header.Get("Range"))
+			switch r.URL.Query().Get("id") {
+			case "zip":
+				w.Header().Set("Content-Disposition", `attachment; filename="archive.ZIP"; filename*=UTF-8''archive.ZIP`)
+			case "missing":
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write([]byte("0"))
+		}))
+		t.Cleanup(ts.Close)
+		c := newTestDownloadClient(t)
+		c.OfficialAPIClient.HTTPClient.RetryMax = 0
+
+		d, err := c.resolveExtension(ctx, EmbeddedAsset{ID: "e1", URL: ts.URL + "?id=zip", extractor: GoogleDriveExtractor{}})
+		require.NoError(t, err)
+		assert.Equal(t, "zip", d.GetExtension())
+
+		d, err = c.resolveExtension(ctx, EmbeddedAsset{ID: "e1", URL: ts.URL + "?id=unknown", extractor: GoogleDriveExtractor{}})
+		require.NoError(t, err)
+		assert.Equal(t, "bin", d.GetExtension())
+
+		_, err = c.resolveExtension(ctx, EmbeddedAsset{ID: "e1", URL: ts.URL + "?id=missing", extractor: GoogleDriveExtractor{}})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestClient_download_CommandExtractor(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not found")
+	}
+	post := loadPostInfo(t, "post_info_video.json")
+
+	newClient := func(t *testing.T, script string) *Client {
+		c := newTestDownloadClient(t)
+		c.Extractors = &ExtractorRegistry{}
+		c.Extractors.Register(&CommandExtractor{
+			Hosts:     []string{"vimeo.com"},
+			Command:   "sh",
+			Args:      []string{"-c", script, "sh", "{url}"},
+			Extension: "mp4",
+		})
+		return c
+	}
+	handleEmbed := func(c *Client) error {
+		assets, err := c.ListPostAssets(post)
+		require.NoError(t, err)
+		require.Len(t, assets, 1)
+		return c.handleAsset(context.Background(), post, assets[0].Order, assets[0].Downloadable)
+	}
+	savedFile := func(c *Client) string {
+		return filepath.Join(c.Storage.(*LocalStorage).SaveDir, "creator", "2022-03-16-video post", "embed-0-video1000003.mp4")
+	}
+
+	t.Run("success", func(t *testing.T) {
+		c := newClient(t, `printf "content of %s" "$1"`)
+		require.NoError(t, handleEmbed(c))
+
+		b, err := os.ReadFile(savedFile(c))
+		require.NoError(t, err)
+		assert.Equal(t, "content of https://vimeo.com/76979871", string(b))
+	})
+
+	t.Run("command failure", func(t *testing.T) {
+		c := newClient(t, `printf "partial"; echo "network error" >&2; exit 1`)
+		err := handleEmbed(c)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "network error")
+		assert.NoFileExists(t, savedFile(c))
+	})
+}
@@ -0,0 +1,89 @@
+package fanbox
+
+import (
+	"regexp"
+	"slices"
+	"time"
+)
+
+// PostFilter selects posts to download by fields of listed posts,
+// so that filtered posts are skipped without getting their bodies.
+// Zero values of fields don't filter posts.
+type PostFilter struct {
+	// Since selects posts published at or after it.
+	Since time.Time
+	// Until selects posts published before it.
+	Until time.Time
+	// MinFee selects posts whose fee is at least it.
+	MinFee *int
+	// MaxFee selects posts whose fee is at most it.
+	MaxFee *int
+	// Title selects posts whose titles match it.
+	Title *regexp.Regexp
+	// ExcludeTitle skips posts whose titles match it.
+	ExcludeTitle *regexp.Regexp
+	// Tags selects posts which have any of the tags.
+	Tags []string
+	// ExcludeTags skips posts which have any of the tags.
+	ExcludeTags []string
+	// PostIDs selects only the posts.
+	PostIDs []string
+}
+
+// Match reports whether the post is selected.
+// Posts whose published date time can't be parsed are selected by the date range.
+func (f *PostFilter) Match(p Post) bool {
+	if f == nil {
+		return true
+	}
+
+	if published, err := time.Parse(time.RFC3339, p.PublishedDateTime); err == nil {
+		if !f.Since.IsZero() && published.Before(f.Since) {
+			return false
+		}
+		if !f.Until.IsZero() && !published.Before(f.Until) {
+			return false
+		}
+	}
+	if f.MinFee != nil && p.FeeRequired < *f.MinFee {
+		return false
+	}
+	if f.MaxFee != nil && p.FeeRequired > *f.MaxFee {
+		return false
+	}
+	if f.Title != nil && !f.Title.MatchString(p.Title) {
+		return false
+	}
+	if f.ExcludeTitle != nil && f.ExcludeTitle.MatchString(p.Title) {
+		return false
+	}
+	if len(f.Tags) > 0 && !hasAnyTag(p, f.Tags) {
+		return false
+	}
+	if hasAnyTag(p, f.ExcludeTags) {
+		return false
+	}
+	if len(f.PostIDs) > 0 && !slices.Contains(f.PostIDs, p.ID) {
+		return false
+	}
+	return true
+}
+
+// isBeforeSince reports whether the post is published before Since,
+// then posts listed after it are older and no longer selected.
+func (f *PostFilter) isBeforeSince(p Post) bool {
+	if f == nil || f.Since.IsZero() {
+		return false
+	}
+	published, err := time.Parse(time.RFC3339, p.PublishedDateTime)
+	return err == nil && published.Before(f.Since)
+}
+
+func hasAnyTag(p Post, tags []string) bool {
+	for _, t := range tags {
+		if slices.Contains(p.Tags, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package fanbox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostFilter_Match(t *testing.T) {
+	post := Post{
+		ID:                "1",
+		Title:             "Weekly sketch #3",
+		PublishedDateTime: "2022-03-17T01:00:00+09:00",
+		FeeRequired:       500,
+		Tags:              []string{"sketch", "diary"},
+	}
+
+	tests := []struct {
+		name   string
+		filter *PostFilter
+		want   bool
+	}{
+		{name: "nil", filter: nil, want: true},
+		{name: "zero", filter: &PostFilter{}, want: true},
+		{name: "since", filter: &PostFilter{Since: time.Date(2022, 3, 16, 16, 0, 0, 0, time.UTC)}, want: true},
+		{name: "after since", filter: &PostFilter{Since: time.Date(2022, 3, 16, 16, 0, 1, 0, time.UTC)}, want: false},
+		{name: "before until", filter: &PostFilter{Until: time.Date(2022, 3, 16, 16, 0, 1, 0, time.UTC)}, want: true},
+		{name: "until is exclusive", filter: &PostFilter{Until: time.Date(2022, 3, 16, 16, 0, 0, 0, time.UTC)}, want: false},
+		{name: "min fee", filter: &PostFilter{MinFee: ptr(500)}, want: true},
+		{name: "below min fee", filter: &PostFilter{MinFee: ptr(501)}, want: false},
+		{name: "above max fee", filter: &PostFilter{MaxFee: ptr(0)}, want: false},
+		{name: "title", filter: &PostFilter{Title: regexp.MustCompile(`(?i)sketch`)}, want: true},
+		{name: "title mismatch", filter: &PostFilter{Title: regexp.MustCompile(`^Monthly`)}, want: false},
+		{name: "exclude title", filter: &PostFilter{ExcludeTitle: regexp.MustCompile(`#\d+`)}, want: false},
+		{name: "tags", filter: &PostFilter{Tags: []string{"comic", "diary"}}, want: true},
+		{name: "tags mismatch", filter: &PostFilter{Tags: []string{"comic"}}, want: false},
+		{name: "exclude tags", filter: &PostFilter{ExcludeTags: []string{"diary"}}, want: false},
+		{name: "post IDs", filter: &PostFilter{PostIDs: []string{"2", "1"}}, want: true},
+		{name: "post IDs mismatch", filter: &PostFilter{PostIDs: []string{"2"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(post))
+		})
+	}
+}
+
+func TestClient_Run_Since(t *testing.T) {
+	client := &Client{
+		CheckAllPosts: true,
+		Filter:        &PostFilter{Since: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), MaxFee: ptr(0)},
+		// the second page and bodies of filtered posts are not in the fake API, getting them fails
+		OfficialAPIClient: newFakeAPIClient(t, fakeAPI{
+			"/post.paginateCreator?creatorId=creator": `{"body":[
+				"https://api.fanbox.cc/post.listCreator?creatorId=creator&limit=10",
+				"https://api.fanbox.cc/post.listCreator?creatorId=creator&limit=10&page=2"
+			]}`,
+			"/post.listCreator?creatorId=creator&limit=10": `{"body":[
+				{"id":"1","title":"pinned","publishedDatetime":"2021-01-01T00:00:00+09:00","creatorId":"creator","isPinned":true},
+				{"id":"2","title":"paid","publishedDatetime":"2022-03-18T01:00:00+09:00","creatorId":"creator","feeRequired":500},
+				{"id":"3","title":"free","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator"},
+				{"id":"4","title":"old","publishedDatetime":"2022-02-01T01:00:00+09:00","creatorId":"creator"}
+			]}`,
+			"/post.info?postId=3": `{"body":{"id":"3","title":"free","type":"text","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator","body":{"text":"free"}}}`,
+		}),
+		Storage: &LocalStorage{SaveDir: t.TempDir()},
+	}
+
+	s, err := client.RunWithSummary(context.Background(), "creator")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), s.PostsScanned)
+}
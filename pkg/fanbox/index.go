@@ -0,0 +1,246 @@
+package fanbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // register "sqlite" driver
+)
+
+// IndexEntry is a record of a downloaded asset.
+type IndexEntry struct {
+	// PostID is empty if the entry was rebuilt from files and the post is unknown.
+	PostID  string
+	AssetID string
+	Path    string // slash-separated path relative to the storage root
+	// Root is the storage root which saved the asset, see RootedStorage.
+	// It is empty if the entry was recorded before roots were recorded.
+	Root      string
+	Size      int64
+	SHA256    string
+	FetchedAt time.Time
+	SourceURL string
+}
+
+// LocalRoot returns the directory which the asset was saved into.
+// Entries recorded without the root are resolved relative to saveDir.
+// It returns false if the asset was saved into a storage other than the local file system.
+func (e IndexEntry) LocalRoot(saveDir string) (string, bool) {
+	if e.Root == "" {
+		return saveDir, true
+	}
+	if !filepath.IsAbs(e.Root) {
+		return "", false
+	}
+	return e.Root, true
+}
+
+// DownloadIndex records downloaded assets.
+// Client consults it before the storage, so that assets are not downloaded again
+// even if they were renamed or moved.
+type DownloadIndex interface {
+	// Lookup returns the entry of the asset, or nil if the asset is not recorded.
+	Lookup(ctx context.Context, postID, assetID string) (*IndexEntry, error)
+	// Record inserts or updates the entry.
+	Record(ctx context.Context, e *IndexEntry) error
+	// Entries returns all entries, such as to verify recorded assets.
+	Entries(ctx context.Context) ([]IndexEntry, error)
+}
+
+// SQLiteIndex is DownloadIndex backed by a SQLite database file.
+type SQLiteIndex struct {
+	db *sql.DB
+}
+
+var _ DownloadIndex = (*SQLiteIndex)(nil)
+
+// OpenSQLiteIndex opens the SQLite database, and creates it if it doesn't exist.
+func OpenSQLiteIndex(ctx context.Context, name string) (*SQLiteIndex, error) {
+	if dir := filepath.Dir(name); dir != "" {
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			return nil, fmt.Errorf("create a directory (%s): %w", dir, err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", name+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	// SQLite allows only one writer, serialize all queries to avoid "database is locked" errors.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS assets (
+	post_id    TEXT NOT NULL,
+	asset_id   TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	size       INTEGER NOT NULL,
+	sha256     TEXT NOT NULL,
+	fetched_at TIMESTAMP NOT NULL,
+	source_url TEXT NOT NULL,
+	root       TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (post_id, asset_id)
+);
+CREATE INDEX IF NOT EXISTS assets_asset_id ON assets (asset_id);`); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create tables: %w", err)
+	}
+	if err := addRootColumn(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &SQLiteIndex{db: db}, nil
+}
+
+// addRootColumn adds the root column to databases created before it was introduced.
+func addRootColumn(ctx context.Context, db *sql.DB) error {
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info('assets') WHERE name = 'root'`).Scan(&n); err != nil {
+		return fmt.Errorf("inspect assets table: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `ALTER TABLE assets ADD COLUMN root TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("add root column: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteIndex) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteIndex) Lookup(ctx context.Context, postID, assetID string) (*IndexEntry, error) {
+	// entries rebuilt from files don't have the post ID, so they match any post
+	row := s.db.QueryRowContext(ctx, `SELECT post_id, asset_id, path, root, size, sha256, fetched_at, source_url FROM assets
+WHERE asset_id = ? AND post_id IN (?, '') ORDER BY post_id DESC LIMIT 1`, assetID, postID)
+
+	var e IndexEntry
+	err := row.Scan(&e.PostID, &e.AssetID, &e.Path, &e.Root, &e.Size, &e.SHA256, &e.FetchedAt, &e.SourceURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select asset: %w", err)
+	}
+	return &e, nil
+}
+
+func (s *SQLiteIndex) Record(ctx context.Context, e *IndexEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if e.PostID != "" {
+		// the post is known now, replace the entry rebuilt from files
+		if _, err := tx.ExecContext(ctx, `DELETE FROM assets WHERE post_id = '' AND asset_id = ?`, e.AssetID); err != nil {
+			return fmt.Errorf("delete rebuilt asset: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO assets (post_id, asset_id, path, root, size, sha256, fetched_at, source_url)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (post_id, asset_id) DO UPDATE SET
+	path = excluded.path,
+	root = excluded.root,
+	size = excluded.size,
+	sha256 = excluded.sha256,
+	fetched_at = excluded.fetched_at,
+	source_url = excluded.source_url`,
+		e.PostID, e.AssetID, e.Path, e.Root, e.Size, e.SHA256, e.FetchedAt.UTC(), e.SourceURL,
+	); err != nil {
+		return fmt.Errorf("upsert asset: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// Entries returns all entries.
+func (s *SQLiteIndex) Entries(ctx context.Context) ([]IndexEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT post_id, asset_id, path, root, size, sha256, fetched_at, source_url FROM assets ORDER BY path`)
+	if err != nil {
+		return nil, fmt.Errorf("select assets: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var res []IndexEntry
+	for rows.Next() {
+		var e IndexEntry
+		if err := rows.Scan(&e.PostID, &e.AssetID, &e.Path, &e.Root, &e.Size, &e.SHA256, &e.FetchedAt, &e.SourceURL); err != nil {
+			return nil, fmt.Errorf("scan asset: %w", err)
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate assets: %w", err)
+	}
+	return res, nil
+}
+
+// RebuildIndex walks saveDir and records assets found by their file names into the index.
+// It returns the number of recorded assets.
+// Recorded entries don't have the post ID, it is filled when the asset is handled by Client.
+func RebuildIndex(ctx context.Context, idx DownloadIndex, saveDir string) (int, error) {
+	var n int
+	err := filepath.WalkDir(saveDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		asset, ok := parseAssetFileName(d.Name())
+		if !ok {
+			return nil
+		}
+
+		rel, err := filepath.Rel(saveDir, name)
+		if err != nil {
+			return fmt.Errorf("relative path of %s: %w", name, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("file info of %s: %w", name, err)
+		}
+		sum, err := hashFile(name)
+		if err != nil {
+			return err
+		}
+
+		if err := idx.Record(ctx, &IndexEntry{
+			AssetID:   asset.ID,
+			Path:      filepath.ToSlash(rel),
+			Root:      localRoot(saveDir),
+			Size:      info.Size(),
+			SHA256:    sum,
+			FetchedAt: info.ModTime(),
+		}); err != nil {
+			return fmt.Errorf("record %s: %w", name, err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, fmt.Errorf("walk %s: %w", saveDir, err)
+	}
+	return n, nil
+}
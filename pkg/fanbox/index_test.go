@@ -0,0 +1,110 @@
+package fanbox
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	idx, err := OpenSQLiteIndex(ctx, filepath.Join(dir, "index.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, idx.Close())
+	})
+
+	saveDir := filepath.Join(dir, "save")
+	require.NoError(t, os.MkdirAll(filepath.Join(saveDir, "creator", "2022-03-15-title"), 0775))
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "2022-03-15-title", "file-0-asset1.zip"), []byte("zip"), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "2022-03-15-title-1-asset2.jpeg"), []byte("jpeg"), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "notes.txt"), []byte("notes"), 0664))
+	// post documents are not assets
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "2022-03-15-title.json"), []byte("{}"), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "2022-03-15-title-1.post.json"), []byte("{}"), 0664))
+
+	n, err := RebuildIndex(ctx, idx, saveDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	e, err := idx.Lookup(ctx, "post1", "asset1")
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, "", e.PostID)
+	assert.Equal(t, "creator/2022-03-15-title/file-0-asset1.zip", e.Path)
+	assert.Equal(t, saveDir, e.Root)
+	assert.Equal(t, int64(3), e.Size)
+
+	fetchedAt := time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, idx.Record(ctx, &IndexEntry{
+		PostID:    "post1",
+		AssetID:   "asset1",
+		Path:      "creator/renamed/file-0-asset1.zip",
+		Size:      3,
+		SHA256:    "sum",
+		FetchedAt: fetchedAt,
+		SourceURL: "https://downloads.fanbox.cc/asset1.zip",
+	}))
+
+	e, err = idx.Lookup(ctx, "post1", "asset1")
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, "post1", e.PostID)
+	assert.Equal(t, "creator/renamed/file-0-asset1.zip", e.Path)
+	assert.True(t, fetchedAt.Equal(e.FetchedAt))
+
+	e, err = idx.Lookup(ctx, "post2", "asset1")
+	require.NoError(t, err)
+	assert.Nil(t, e, "rebuilt entry should be replaced by the recorded entry")
+
+	e, err = idx.Lookup(ctx, "post1", "unknown")
+	require.NoError(t, err)
+	assert.Nil(t, e)
+}
+
+func TestOpenSQLiteIndex_AddsRootColumn(t *testing.T) {
+	ctx := context.Background()
+	name := filepath.Join(t.TempDir(), "index.db")
+
+	// the schema before roots were recorded
+	db, err := sql.Open("sqlite", name)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `CREATE TABLE assets (
+	post_id    TEXT NOT NULL,
+	asset_id   TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	size       INTEGER NOT NULL,
+	sha256     TEXT NOT NULL,
+	fetched_at TIMESTAMP NOT NULL,
+	source_url TEXT NOT NULL,
+	PRIMARY KEY (post_id, asset_id)
+);
+INSERT INTO assets VALUES ('post1', 'asset1', 'file-0-asset1.zip', 3, 'sum', '2022-03-15 00:00:00', '');`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	idx, err := OpenSQLiteIndex(ctx, name)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, idx.Close())
+	})
+
+	e, err := idx.Lookup(ctx, "post1", "asset1")
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, "", e.Root)
+
+	require.NoError(t, idx.Record(ctx, &IndexEntry{PostID: "post1", AssetID: "asset1", Path: "file-0-asset1.zip", Root: "/archive"}))
+	e, err = idx.Lookup(ctx, "post1", "asset1")
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, "/archive", e.Root)
+}
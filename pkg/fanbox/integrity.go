@@ -0,0 +1,138 @@
+package fanbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// hashingReader counts bytes and computes SHA-256 of the content while reading.
+// If wantSize is not negative, reading fails when the content size doesn't match it.
+type hashingReader struct {
+	r        io.Reader
+	h        hash.Hash
+	size     int64
+	wantSize int64
+}
+
+func newHashingReader(r io.Reader, wantSize int64) *hashingReader {
+	return &hashingReader{r: r, h: sha256.New(), wantSize: wantSize}
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.size += int64(n)
+	_, _ = r.h.Write(p[:n])
+
+	if r.wantSize >= 0 {
+		if r.size > r.wantSize {
+			return n, fmt.Errorf("want %d bytes but got more: %w", r.wantSize, errPartialContentMismatch)
+		}
+		if errors.Is(err, io.EOF) && r.size < r.wantSize {
+			return n, fmt.Errorf("want %d bytes but got %d bytes: %w", r.wantSize, r.size, io.ErrUnexpectedEOF)
+		}
+	}
+	return n, err
+}
+
+// seed hashes and counts the content which was read before, such as a partial file.
+func (r *hashingReader) seed(prev io.Reader) error {
+	n, err := io.Copy(r.h, prev)
+	r.size += n
+	return err
+}
+
+func (r *hashingReader) Sum() string {
+	return hex.EncodeToString(r.h.Sum(nil))
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("open a file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash a file (%s): %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyProblem is the kind of problems found by Verify.
+type VerifyProblem string
+
+const (
+	VerifyMissing   VerifyProblem = "missing"
+	VerifyTruncated VerifyProblem = "truncated"
+	VerifyCorrupted VerifyProblem = "corrupted"
+)
+
+// VerifyIssue is a problem of a recorded asset.
+type VerifyIssue struct {
+	Entry   IndexEntry
+	Problem VerifyProblem
+}
+
+// Verify re-hashes the assets recorded in the index, and reports missing, truncated or corrupted ones.
+// Paths of the entries are resolved relative to their recorded roots, or saveDir if the root isn't recorded.
+// Assets saved into other storages than the local file system, such as S3, are skipped.
+// It returns the issues and the number of checked assets.
+func Verify(ctx context.Context, idx DownloadIndex, saveDir string) ([]VerifyIssue, int, error) {
+	entries, err := idx.Entries(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list index entries: %w", err)
+	}
+
+	var issues []VerifyIssue
+	var checked int
+	skipped := make(map[string]int)
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return issues, checked, err
+		}
+
+		root, ok := e.LocalRoot(saveDir)
+		if !ok {
+			skipped[e.Root]++
+			continue
+		}
+		checked++
+
+		name := filepath.Join(root, filepath.FromSlash(e.Path))
+		info, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			issues = append(issues, VerifyIssue{Entry: e, Problem: VerifyMissing})
+			continue
+		}
+		if err != nil {
+			return issues, checked, fmt.Errorf("stat file: %w", err)
+		}
+		if info.Size() < e.Size {
+			issues = append(issues, VerifyIssue{Entry: e, Problem: VerifyTruncated})
+			continue
+		}
+
+		sum, err := hashFile(name)
+		if err != nil {
+			return issues, checked, err
+		}
+		if info.Size() != e.Size || sum != e.SHA256 {
+			issues = append(issues, VerifyIssue{Entry: e, Problem: VerifyCorrupted})
+		}
+	}
+	for root, n := range skipped {
+		slog.WarnContext(ctx, "Skipped assets which weren't saved into the local file system", "root", root, "assets", n)
+	}
+	return issues, checked, nil
+}
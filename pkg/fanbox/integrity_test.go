@@ -0,0 +1,125 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashingReader(t *testing.T) {
+	r := newHashingReader(strings.NewReader("content"), 7)
+	_, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), r.size)
+	assert.Equal(t, "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73", r.Sum())
+
+	_, err = io.ReadAll(newHashingReader(strings.NewReader("short"), 7))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = io.ReadAll(newHashingReader(strings.NewReader("too long content"), 7))
+	assert.ErrorIs(t, err, errPartialContentMismatch)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	idx, err := OpenSQLiteIndex(ctx, filepath.Join(dir, "index.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, idx.Close())
+	})
+
+	saveDir := filepath.Join(dir, "save")
+	require.NoError(t, os.MkdirAll(saveDir, 0775))
+	files := map[string]string{
+		"ok-0-asset1.jpeg":        "content",
+		"truncated-0-asset2.jpeg": "cont",
+		"corrupted-0-asset3.jpeg": "CONTENT",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(saveDir, name), []byte(content), 0664))
+	}
+
+	for i, name := range []string{"ok-0-asset1.jpeg", "truncated-0-asset2.jpeg", "corrupted-0-asset3.jpeg", "missing-0-asset4.jpeg"} {
+		require.NoError(t, idx.Record(ctx, &IndexEntry{
+			PostID:    "post1",
+			AssetID:   "asset" + string(rune('1'+i)),
+			Path:      name,
+			Size:      7,
+			SHA256:    "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+			FetchedAt: time.Now(),
+		}))
+	}
+
+	// assets saved into other roots, such as save dirs of creators and S3
+	otherDir := filepath.Join(dir, "other")
+	require.NoError(t, os.MkdirAll(otherDir, 0775))
+	require.NoError(t, os.WriteFile(filepath.Join(otherDir, "ok-0-asset5.jpeg"), []byte("content"), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(otherDir, "corrupted-0-asset6.jpeg"), []byte("CONTENT"), 0664))
+	for i, name := range []string{"ok-0-asset5.jpeg", "corrupted-0-asset6.jpeg"} {
+		require.NoError(t, idx.Record(ctx, &IndexEntry{
+			PostID:  "post2",
+			AssetID: "asset" + string(rune('5'+i)),
+			Path:    name,
+			Root:    otherDir,
+			Size:    7,
+			SHA256:  "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+		}))
+	}
+	require.NoError(t, idx.Record(ctx, &IndexEntry{
+		PostID:  "post3",
+		AssetID: "asset7",
+		Path:    "s3-0-asset7.jpeg",
+		Root:    "s3://bucket/prefix",
+		Size:    7,
+	}))
+
+	issues, checked, err := Verify(ctx, idx, saveDir)
+	require.NoError(t, err)
+	assert.Equal(t, 6, checked)
+
+	got := map[string]VerifyProblem{}
+	for _, issue := range issues {
+		got[issue.Entry.Path] = issue.Problem
+	}
+	assert.Equal(t, map[string]VerifyProblem{
+		"truncated-0-asset2.jpeg": VerifyTruncated,
+		"corrupted-0-asset3.jpeg": VerifyCorrupted,
+		"missing-0-asset4.jpeg":   VerifyMissing,
+		"corrupted-0-asset6.jpeg": VerifyCorrupted,
+	}, got)
+}
+
+func TestClient_Refetch(t *testing.T) {
+	ctx := context.Background()
+	storage := &LocalStorage{SaveDir: t.TempDir(), DirByPost: true}
+	client := &Client{
+		OfficialAPIClient: newFakeAPIClient(t, fakeAPI{
+			"/post.info?postId=1": `{"body":{"id":"1","title":"images","type":"image","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator",
+				"body":{"images":[{"id":"img1","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img1.png"}]}
+			}}`,
+			"/images/img1.png": "png1",
+		}),
+		Storage: storage,
+	}
+
+	// recorded in the flat layout
+	loc, err := client.Refetch(ctx, IndexEntry{PostID: "1", AssetID: "img1", Path: "creator/2022-03-16-images-0-img1.png"})
+	require.NoError(t, err)
+	assert.Equal(t, "creator/2022-03-16-images/0-img1.png", loc)
+
+	b, err := os.ReadFile(filepath.Join(storage.SaveDir, filepath.FromSlash(loc)))
+	require.NoError(t, err)
+	assert.Equal(t, "png1", string(b))
+
+	_, err = client.Refetch(ctx, IndexEntry{PostID: "1", AssetID: "unknown"})
+	assert.ErrorContains(t, err, "not found")
+}
@@ -0,0 +1,222 @@
+package fanbox
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/hareku/go-filename"
+	"github.com/hareku/go-strlimit"
+)
+
+// layout decides where assets are saved, it is shared by storages to keep the same structure.
+type layout struct {
+	DirByPost bool
+	DirByPlan bool
+	// PathTemplate overrides DirByPost and DirByPlan if it is set.
+	PathTemplate *PathTemplate
+	// OriginalFileNames is whether to name files by their uploaded names instead of IDs.
+	OriginalFileNames bool
+
+	RemoveUnprintableChars bool
+}
+
+// limitOsSafely limits the string length for OS safely.
+func (l layout) limitOsSafely(name string) string {
+	switch runtime.GOOS {
+	case "windows":
+		return strlimit.LimitRunesWithEnd(name, 210, "...")
+	default:
+		return strlimit.LimitBytesWithEnd(name, 250, "...")
+	}
+}
+
+func (l layout) template() *PathTemplate {
+	if l.PathTemplate != nil {
+		return l.PathTemplate
+	}
+
+	name := "flat"
+	switch {
+	case l.DirByPlan && l.DirByPost:
+		name = "dir-by-plan-and-post"
+	case l.DirByPlan:
+		name = "dir-by-plan"
+	case l.DirByPost:
+		name = "dir-by-post"
+	}
+	return pathTemplatePresets[name]
+}
+
+// postData returns the template data of the post.
+func (l layout) postData(post Post) (PathTemplateData, error) {
+	date, err := time.Parse(time.RFC3339, post.PublishedDateTime)
+	if err != nil {
+		return PathTemplateData{}, fmt.Errorf("parse post published date time %s: %w", post.PublishedDateTime, err)
+	}
+
+	return PathTemplateData{
+		CreatorID:   post.CreatorID,
+		PostID:      post.ID,
+		Title:       strings.TrimSpace(filename.EscapeString(post.Title, "-")),
+		PublishedAt: date.UTC(),
+		FeeRequired: post.FeeRequired,
+	}, nil
+}
+
+// assetPath returns the path elements of the asset relative to the save directory.
+func (l layout) assetPath(post Post, order int, d Downloadable) ([]string, error) {
+	data, err := l.postData(post)
+	if err != nil {
+		return nil, err
+	}
+	data.Order = order
+	data.AssetID = d.GetID()
+	data.Extension = d.GetExtension()
+	switch v := d.(type) {
+	case Image:
+		data.AssetType = "image"
+	case File:
+		data.AssetType = "file"
+		data.OriginalName = originalFileName(post, v)
+		data.UseOriginalName = l.OriginalFileNames && data.OriginalName != ""
+	case EmbeddedAsset:
+		data.AssetType = "embed"
+	}
+
+	return l.segments(l.template().asset, data)
+}
+
+// legacyAssetPath returns the ID based path of the asset, which is used when OriginalFileNames is disabled.
+// It returns nil if the asset is not named by its original name.
+func (l layout) legacyAssetPath(post Post, order int, d Downloadable) ([]string, error) {
+	if _, ok := d.(File); !ok || !l.OriginalFileNames {
+		return nil, nil
+	}
+	l.OriginalFileNames = false
+	return l.assetPath(post, order, d)
+}
+
+// originalFileName returns the escaped name of the file.
+// If an earlier file of the post has the same name, the asset ID is appended to keep names unique.
+func originalFileName(post Post, file File) string {
+	escape := func(f File) string {
+		return strings.TrimSpace(filename.EscapeString(f.Name, "-"))
+	}
+
+	name := escape(file)
+	if name == "" {
+		return ""
+	}
+	for _, d := range post.ListDownloadable() {
+		other, ok := d.(File)
+		if !ok {
+			continue
+		}
+		if other.ID == file.ID {
+			break
+		}
+		// case-insensitive file systems treat them as the same file
+		if strings.EqualFold(escape(other), name) && strings.EqualFold(other.Extension, file.Extension) {
+			return name + "-" + file.ID
+		}
+	}
+	return name
+}
+
+// postDocumentPath returns the path elements of the document of the post, such as post.json.
+func (l layout) postDocumentPath(post Post, name, ext string) ([]string, error) {
+	data, err := l.postData(post)
+	if err != nil {
+		return nil, err
+	}
+	data.Name = name
+	data.Extension = ext
+
+	return l.segments(l.template().document, data)
+}
+
+// segments executes the template, and sanitizes each path segment.
+// The extension of the last segment is kept when its length is limited.
+// Templates fail with some data, such as {{slice .Title 0 3}} with a short title.
+func (l layout) segments(t *template.Template, data PathTemplateData) ([]string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("execute path template %q: %w", t.Name(), err)
+	}
+
+	var res []string
+	for _, seg := range strings.Split(b.String(), "/") {
+		if l.RemoveUnprintableChars {
+			seg = strings.Map(func(r rune) rune {
+				if unicode.IsPrint(r) {
+					return r
+				}
+				return -1
+			}, seg)
+		}
+		if seg == "" || seg == "." || seg == ".." {
+			continue
+		}
+		res = append(res, seg)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("path template %q results in an empty path", t.Name())
+	}
+
+	for i, seg := range res {
+		if i < len(res)-1 {
+			res[i] = l.limitOsSafely(seg)
+			continue
+		}
+		if base, ok := strings.CutSuffix(seg, "."+data.Extension); ok && data.Extension != "" {
+			res[i] = l.limitOsSafely(base) + "." + data.Extension
+		} else {
+			res[i] = l.limitOsSafely(seg)
+		}
+	}
+	return res, nil
+}
+
+var (
+	assetFileNameRegexp = regexp.MustCompile(`(?:^|-)(?:(file|embed)-)?(\d+)-([0-9A-Za-z]+)\.([0-9A-Za-z]+)$`)
+	// postDateRegexp matches the published date which names of posts start with.
+	postDateRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-`)
+)
+
+// assetFileName is the information embedded in the file name made by assetPath.
+type assetFileName struct {
+	ID string
+	// Type is "image", "file" or "embed".
+	Type      string
+	Order     int
+	Extension string
+}
+
+// parseAssetFileName parses the file name made by assetPath.
+// Post documents are not assets, such as "2006-01-02-title.json" saved by older versions in flat layouts.
+func parseAssetFileName(name string) (assetFileName, bool) {
+	m := assetFileNameRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return assetFileName{}, false
+	}
+	// asset names follow the title, so the day of the date is not an order
+	if loc := assetFileNameRegexp.FindStringIndex(name); loc[0] == len("2006-01") && postDateRegexp.MatchString(name) {
+		return assetFileName{}, false
+	}
+	order, err := strconv.Atoi(m[2])
+	if err != nil {
+		return assetFileName{}, false
+	}
+
+	res := assetFileName{ID: m[3], Type: m[1], Order: order, Extension: m[4]}
+	if res.Type == "" {
+		res.Type = "image"
+	}
+	return res, true
+}
@@ -0,0 +1,197 @@
+package fanbox
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// joinedPath returns the function which joins path elements returned by layout.
+func joinedPath(t *testing.T) func([]string, error) string {
+	return func(p []string, err error) string {
+		t.Helper()
+		require.NoError(t, err)
+		return path.Join(p...)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	post := Post{
+		ID:                "post1",
+		Title:             "images/files",
+		PublishedDateTime: "2022-03-17T01:00:00+09:00",
+		CreatorID:         "creator",
+		FeeRequired:       500,
+	}
+
+	tests := []struct {
+		layout   layout
+		wantImg  string
+		wantFile string
+		wantDoc  string
+	}{
+		{
+			layout:   layout{},
+			wantImg:  "creator/2022-03-16-images-files-0-img1.jpeg",
+			wantFile: "creator/2022-03-16-images-files-file-1-file1.zip",
+			wantDoc:  "creator/2022-03-16-images-files-post1.post.json",
+		},
+		{
+			layout:   layout{DirByPost: true},
+			wantImg:  "creator/2022-03-16-images-files/0-img1.jpeg",
+			wantFile: "creator/2022-03-16-images-files/file-1-file1.zip",
+			wantDoc:  "creator/2022-03-16-images-files/post.json",
+		},
+		{
+			layout:   layout{DirByPlan: true},
+			wantImg:  "creator/500yen/2022-03-16-images-files-0-img1.jpeg",
+			wantFile: "creator/500yen/2022-03-16-images-files-file-1-file1.zip",
+			wantDoc:  "creator/500yen/2022-03-16-images-files-post1.post.json",
+		},
+		{
+			layout:   layout{DirByPost: true, DirByPlan: true},
+			wantImg:  "creator/500yen/2022-03-16-images-files/0-img1.jpeg",
+			wantFile: "creator/500yen/2022-03-16-images-files/file-1-file1.zip",
+			wantDoc:  "creator/500yen/2022-03-16-images-files/post.json",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.wantImg, joinedPath(t)(tt.layout.assetPath(post, 0, Image{ID: "img1", Extension: "jpeg"})))
+		assert.Equal(t, tt.wantFile, joinedPath(t)(tt.layout.assetPath(post, 1, File{ID: "file1", Extension: "zip"})))
+		assert.Equal(t, tt.wantDoc, joinedPath(t)(tt.layout.postDocumentPath(post, "post", "json")))
+	}
+}
+
+func TestLayout_PathTemplate(t *testing.T) {
+	post := Post{
+		ID:                "post1",
+		Title:             "images/files",
+		PublishedDateTime: "2022-03-17T01:00:00+09:00",
+		CreatorID:         "creator",
+		FeeRequired:       500,
+	}
+
+	t.Run("preset", func(t *testing.T) {
+		tmpl, err := NewPathTemplate("dir-by-plan-and-post", "")
+		require.NoError(t, err)
+		l := layout{PathTemplate: tmpl}
+		assert.Equal(t, "creator/500yen/2022-03-16-images-files/file-1-file1.zip", joinedPath(t)(l.assetPath(post, 1, File{ID: "file1", Extension: "zip"})))
+	})
+
+	t.Run("preset with post document template", func(t *testing.T) {
+		tmpl, err := NewPathTemplate("flat", `{{.CreatorID}}/docs/{{.PostID}}.{{.Name}}.{{.Extension}}`)
+		require.NoError(t, err)
+		l := layout{PathTemplate: tmpl}
+		assert.Equal(t, "creator/2022-03-16-images-files-file-1-file1.zip", joinedPath(t)(l.assetPath(post, 1, File{ID: "file1", Extension: "zip"})))
+		assert.Equal(t, "creator/docs/post1.post.json", joinedPath(t)(l.postDocumentPath(post, "post", "json")))
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		tmpl, err := NewPathTemplate(`{{.CreatorID}}/{{.PublishedAt.Year}}/{{.Title}} [{{.PostID}}]/{{.AssetType}}s/{{.Order}}-{{.OriginalName}}.{{.Extension}}`, "")
+		require.NoError(t, err)
+		l := layout{PathTemplate: tmpl}
+
+		assert.Equal(t, "creator/2022/images-files [post1]/files/1-my-archive v2.zip",
+			joinedPath(t)(l.assetPath(post, 1, File{ID: "file1", Name: "my/archive v2", Extension: "zip"})))
+		assert.Equal(t, "creator/2022-03-16-images-files/post.json", joinedPath(t)(l.postDocumentPath(post, "post", "json")))
+	})
+
+	t.Run("limit segments keeping the extension", func(t *testing.T) {
+		tmpl, err := NewPathTemplate(`{{.CreatorID}}//{{.Title}}/{{.Title}}.{{.Extension}}`, "")
+		require.NoError(t, err)
+		l := layout{PathTemplate: tmpl}
+
+		long := post
+		long.Title = strings.Repeat("a", 300)
+		got, err := l.assetPath(long, 0, Image{ID: "img1", Extension: "jpeg"})
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		assert.Equal(t, l.limitOsSafely(long.Title), got[1])
+		assert.Equal(t, l.limitOsSafely(long.Title)+".jpeg", got[2])
+	})
+
+	t.Run("execution error", func(t *testing.T) {
+		tmpl, err := NewPathTemplate(`{{.CreatorID}}/{{slice .Title 0 3}}/{{.AssetID}}.{{.Extension}}`, "")
+		require.NoError(t, err)
+		l := layout{PathTemplate: tmpl}
+
+		short := post
+		short.Title = "ab"
+		_, err = l.assetPath(short, 0, Image{ID: "img1", Extension: "jpeg"})
+		assert.Error(t, err)
+		broken := post
+		broken.PublishedDateTime = "unknown"
+		_, err = l.postDocumentPath(broken, "post", "json")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewPathTemplate(`{{.Unknown}}`, "")
+		assert.Error(t, err)
+		_, err = NewPathTemplate(`{{.CreatorID}`, "")
+		assert.Error(t, err)
+		_, err = NewPathTemplate(`/{{.OriginalName}}/`, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestLayout_OriginalFileNames(t *testing.T) {
+	files := []File{
+		{ID: "file1", Name: "archive", Extension: "zip"},
+		{ID: "file2", Name: "ARCHIVE", Extension: "zip"},
+		{ID: "file3", Name: "archive", Extension: "pdf"},
+		{ID: "file4", Name: "a/b: c?", Extension: "psd"},
+		{ID: "file5", Name: "", Extension: "psd"},
+	}
+	post := Post{
+		ID:                "post1",
+		Title:             "files",
+		PublishedDateTime: "2022-03-17T01:00:00+09:00",
+		CreatorID:         "creator",
+		Body:              &PostBody{Files: &files},
+	}
+
+	l := layout{DirByPost: true, OriginalFileNames: true}
+	var got []string
+	for i, f := range files {
+		got = append(got, joinedPath(t)(l.assetPath(post, i, f)))
+	}
+	assert.Equal(t, []string{
+		"creator/2022-03-16-files/archive.zip",
+		"creator/2022-03-16-files/ARCHIVE-file2.zip",
+		"creator/2022-03-16-files/archive.pdf",
+		"creator/2022-03-16-files/a-b- c-.psd",
+		"creator/2022-03-16-files/file-4-file5.psd",
+	}, got)
+
+	flat := layout{OriginalFileNames: true}
+	assert.Equal(t, "creator/2022-03-16-files-archive.zip", joinedPath(t)(flat.assetPath(post, 0, files[0])))
+
+	assert.Equal(t, "creator/2022-03-16-files/file-0-file1.zip", joinedPath(t)(l.legacyAssetPath(post, 0, files[0])))
+	legacy, err := l.legacyAssetPath(post, 0, Image{ID: "img1", Extension: "jpeg"})
+	require.NoError(t, err)
+	assert.Nil(t, legacy)
+}
+
+func TestParseAssetFileName(t *testing.T) {
+	for name, want := range map[string]assetFileName{
+		"2022-03-15-title-0-JF8xFtFv8uoQG2k7DS8Qg1rn.jpeg":      {ID: "JF8xFtFv8uoQG2k7DS8Qg1rn", Type: "image", Order: 0, Extension: "jpeg"},
+		"2022-03-15-part-2-file-1-3mj6rAzFLrhm197FetXpMdFb.zip": {ID: "3mj6rAzFLrhm197FetXpMdFb", Type: "file", Order: 1, Extension: "zip"},
+		"file-0-SPyMpjKtXR20vrcHLu1jRu54.jpeg":                  {ID: "SPyMpjKtXR20vrcHLu1jRu54", Type: "file", Order: 0, Extension: "jpeg"},
+		"embed-0-video1000003.mp4":                              {ID: "video1000003", Type: "embed", Order: 0, Extension: "mp4"},
+		"12-img1.png":                                           {ID: "img1", Type: "image", Order: 12, Extension: "png"},
+		"post.json":                                             {},
+		"2022-03-15-title.json":                                 {},
+		"2022-03-15-part-2-12345.post.json":                     {},
+		"2022-03-15-t-12345.index.md":                           {},
+		"JF8xFtFv8uoQG2k7DS8Qg1rn.jpeg.part":                    {},
+	} {
+		got, ok := parseAssetFileName(name)
+		assert.Equal(t, want != assetFileName{}, ok, name)
+		assert.Equal(t, want, got, name)
+	}
+}
@@ -1,29 +1,67 @@
 package fanbox
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"time"
-	"unicode"
-
-	"github.com/hareku/go-filename"
-	"github.com/hareku/go-strlimit"
 )
 
+// LocalStorage saves assets into the local file system.
 type LocalStorage struct {
 	SaveDir   string
 	DirByPost bool
 	DirByPlan bool
+	// PathTemplate overrides DirByPost and DirByPlan if it is set.
+	PathTemplate *PathTemplate
+	// OriginalFileNames is whether to name files by their uploaded names instead of IDs.
+	// Files saved by their IDs before enabling it are still detected.
+	OriginalFileNames bool
 
 	RemoveUnprintableChars bool
 }
 
-func (s *LocalStorage) Save(post Post, order int, d Downloadable, r io.Reader) error {
-	name := s.makeFileName(post, order, d)
+var _ Storage = (*LocalStorage)(nil)
+
+const (
+	// partFileSuffix is the suffix of temporary files which are being written.
+	partFileSuffix = ".part"
+	// partValidatorSuffix is appended to the name of the temporary file,
+	// the file holds the validator of the partial content to resume downloading.
+	partValidatorSuffix = ".validator"
+)
+
+var (
+	_ ResumableStorage    = (*LocalStorage)(nil)
+	_ PostDocumentStorage = (*LocalStorage)(nil)
+	_ RootedStorage       = (*LocalStorage)(nil)
+)
+
+// Root returns the absolute path of SaveDir.
+func (s *LocalStorage) Root() string {
+	return localRoot(s.SaveDir)
+}
+
+// localRoot returns the absolute path of the directory, or the cleaned path if it can't be resolved.
+func localRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Clean(dir)
+	}
+	return abs
+}
+
+// Save writes the asset into a temporary file and renames it on success,
+// so that a crash never leaves a truncated file at the final path.
+func (s *LocalStorage) Save(_ context.Context, post Post, order int, d Downloadable, r io.Reader) error {
+	name, err := s.makeFileName(post, order, d)
+	if err != nil {
+		return err
+	}
 
 	dir := filepath.Dir(name)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -33,108 +71,309 @@ func (s *LocalStorage) Save(post Post, order int, d Downloadable, r io.Reader) e
 		}
 	}
 
-	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0775)
+	partName := s.makePartFileName(name, d)
+	if err := writeFileSync(partName, r); err != nil {
+		if removeErr := os.Remove(partName); removeErr != nil && !os.IsNotExist(removeErr) {
+			return fmt.Errorf("%w, and couldn't remove a crashed file (%s): %w", err, partName, removeErr)
+		}
+		return err
+	}
+
+	if err := os.Rename(partName, name); err != nil {
+		return fmt.Errorf("rename a file (%s): %w", partName, err)
+	}
+	if err := os.Remove(partName + partValidatorSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove a validator file: %w", err)
+	}
+
+	return nil
+}
+
+// OpenPartial opens the temporary file of the asset to resume downloading.
+func (s *LocalStorage) OpenPartial(_ context.Context, post Post, order int, d Downloadable) (PartialAsset, error) {
+	name, err := s.makeFileName(post, order, d)
 	if err != nil {
-		return fmt.Errorf("open a file: %w", err)
+		return nil, err
+	}
+
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return nil, fmt.Errorf("create a directory (%s): %w", dir, err)
 	}
-	defer func() {
-		_ = file.Close()
-	}()
 
-	_, err = io.Copy(file, r)
+	partName := s.makePartFileName(name, d)
+	file, err := os.OpenFile(partName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0775)
+	if err != nil {
+		return nil, fmt.Errorf("open a file: %w", err)
+	}
+	info, err := file.Stat()
 	if err != nil {
-		// Remove the crashed file
-		fileName := file.Name()
 		_ = file.Close()
+		return nil, fmt.Errorf("stat a file: %w", err)
+	}
 
-		if removeRrr := os.Remove(fileName); removeRrr != nil {
-			return fmt.Errorf("file copying error and couldn't remove a crashed file (%s): %w", file.Name(), removeRrr)
-		}
+	validator, err := os.ReadFile(partName + partValidatorSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		_ = file.Close()
+		return nil, fmt.Errorf("read a validator file: %w", err)
+	}
 
-		return fmt.Errorf("file copying error: %w", err)
+	return &localPartialAsset{
+		file:      file,
+		name:      name,
+		size:      info.Size(),
+		validator: string(validator),
+	}, nil
+}
+
+func (s *LocalStorage) SavePostDocument(_ context.Context, post Post, name, ext string, r io.Reader) error {
+	loc, err := s.PostDocumentLocation(post, name, ext)
+	if err != nil {
+		return err
+	}
+	fileName := filepath.Join(s.SaveDir, filepath.FromSlash(loc))
+
+	dir := filepath.Dir(fileName)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return fmt.Errorf("create a directory (%s): %w", dir, err)
+	}
+
+	partName := filepath.Join(dir, fmt.Sprintf("%s-%s.%s%s", post.ID, name, ext, partFileSuffix))
+	if err := writeFileSync(partName, r); err != nil {
+		_ = os.Remove(partName)
+		return err
+	}
+	if err := os.Rename(partName, fileName); err != nil {
+		return fmt.Errorf("rename a file (%s): %w", partName, err)
 	}
 
 	return nil
 }
 
-func (s *LocalStorage) Exist(post Post, order int, d Downloadable) (bool, error) {
-	_, err := os.Stat(s.makeFileName(post, order, d))
-	if os.IsNotExist(err) {
-		return false, nil
-	}
+// writeFileSync writes r into the file, and flushes it to the disk.
+func writeFileSync(name string, r io.Reader) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0775)
 	if err != nil {
-		return false, fmt.Errorf("stat file: %w", err)
+		return fmt.Errorf("open a file: %w", err)
 	}
+	defer func() {
+		_ = file.Close()
+	}()
 
-	return true, nil
+	if _, err := io.Copy(file, r); err != nil {
+		return fmt.Errorf("file copying error: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync a file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close a file: %w", err)
+	}
+
+	return nil
 }
 
-// limitOsSafely limits the string length for OS safely.
-func (s *LocalStorage) limitOsSafely(name string) string {
-	switch runtime.GOOS {
-	case "windows":
-		return strlimit.LimitRunesWithEnd(name, 210, "...")
-	default:
-		return strlimit.LimitBytesWithEnd(name, 250, "...")
+// RemovePartFiles removes temporary files left by interrupted downloads in SaveDir,
+// except for files which can be resumed.
+// It returns the number of removed files.
+func (s *LocalStorage) RemovePartFiles() (int, error) {
+	var n int
+	err := filepath.WalkDir(s.SaveDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == s.SaveDir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		var resumable bool
+		switch {
+		case strings.HasSuffix(d.Name(), partFileSuffix):
+			resumable = fileExists(name + partValidatorSuffix)
+		case strings.HasSuffix(d.Name(), partFileSuffix+partValidatorSuffix):
+			resumable = fileExists(strings.TrimSuffix(name, partValidatorSuffix))
+		default:
+			return nil
+		}
+		if resumable {
+			return nil
+		}
+
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("remove a file: %w", err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, fmt.Errorf("walk %s: %w", s.SaveDir, err)
 	}
+	return n, nil
 }
 
-func (s *LocalStorage) makeFileName(post Post, order int, d Downloadable) string {
-	date, err := time.Parse(time.RFC3339, post.PublishedDateTime)
+func (s *LocalStorage) Exist(_ context.Context, post Post, order int, d Downloadable) (bool, error) {
+	name, err := s.makeFileName(post, order, d)
+	if err != nil {
+		return false, err
+	}
+	names := []string{name}
+	legacy, err := s.layout().legacyAssetPath(post, order, d)
 	if err != nil {
-		panic(fmt.Errorf("parse post published date time %s: %w", post.PublishedDateTime, err))
+		return false, err
+	}
+	if legacy != nil {
+		names = append(names, filepath.Join(append([]string{s.SaveDir}, legacy...)...))
 	}
 
-	title := strings.TrimSpace(filename.EscapeString(post.Title, "-"))
-	if s.RemoveUnprintableChars {
-		title = strings.Map(func(r rune) rune {
-			if unicode.IsPrint(r) {
-				return r
-			}
-			return -1
-		}, title)
+	for _, name := range names {
+		_, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("stat file: %w", err)
+		}
+		return true, nil
 	}
+	return false, nil
+}
 
-	fileType := ""
-	// for backward-compatibility, insert "-file-" identifier
-	if _, ok := d.(File); ok {
-		fileType = "file-"
+func (s *LocalStorage) Location(post Post, order int, d Downloadable) (string, error) {
+	p, err := s.layout().assetPath(post, order, d)
+	if err != nil {
+		return "", err
 	}
+	return path.Join(p...), nil
+}
 
-	planDir := ""
-	if s.DirByPlan {
-		planDir = fmt.Sprintf("%dyen", post.FeeRequired)
+func (s *LocalStorage) PostDocumentLocation(post Post, name, ext string) (string, error) {
+	p, err := s.layout().postDocumentPath(post, name, ext)
+	if err != nil {
+		return "", err
 	}
+	return path.Join(p...), nil
+}
 
-	if s.DirByPost {
-		// [SaveDirectory]/[CreatorID]/2006-01-02-[Post Title]/[Order]-[ID].[Extension]
-		return filepath.Join(
-			s.SaveDir,
-			post.CreatorID,
-			planDir,
-			s.limitOsSafely(fmt.Sprintf("%s-%s", date.UTC().Format("2006-01-02"), title)),
-			fmt.Sprintf("%s%d-%s.%s", fileType, order, d.GetID(), d.GetExtension()),
-		)
+func (s *LocalStorage) makeFileName(post Post, order int, d Downloadable) (string, error) {
+	p, err := s.layout().assetPath(post, order, d)
+	if err != nil {
+		return "", err
 	}
+	return filepath.Join(append([]string{s.SaveDir}, p...)...), nil
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
 
-	// [SaveDirectory]/[CreatorID]/2006-01-02-[Post Title]-[Order]-[ID].[Extension]
+// makePartFileName returns the temporary file name of the asset saved as name.
+// It is not derived from the final name to keep it short enough for file systems.
+func (s *LocalStorage) makePartFileName(name string, d Downloadable) string {
 	return filepath.Join(
-		s.SaveDir,
-		post.CreatorID,
-		planDir,
-		fmt.Sprintf(
-			"%s.%s",
-			s.limitOsSafely(
-				fmt.Sprintf(
-					"%s-%s-%s%d-%s",
-					date.UTC().Format("2006-01-02"),
-					title,
-					fileType,
-					order,
-					d.GetID(),
-				),
-			),
-			d.GetExtension(),
-		),
+		filepath.Dir(name),
+		fmt.Sprintf("%s.%s%s", d.GetID(), d.GetExtension(), partFileSuffix),
 	)
 }
+
+func (s *LocalStorage) layout() layout {
+	return layout{
+		DirByPost:              s.DirByPost,
+		DirByPlan:              s.DirByPlan,
+		PathTemplate:           s.PathTemplate,
+		OriginalFileNames:      s.OriginalFileNames,
+		RemoveUnprintableChars: s.RemoveUnprintableChars,
+	}
+}
+
+// localPartialAsset is PartialAsset of LocalStorage.
+type localPartialAsset struct {
+	file      *os.File
+	name      string
+	size      int64
+	validator string
+	readOff   int64
+	committed bool
+	closed    bool
+}
+
+func (p *localPartialAsset) Read(b []byte) (int, error) {
+	n, err := p.file.ReadAt(b, p.readOff)
+	p.readOff += int64(n)
+	return n, err
+}
+
+func (p *localPartialAsset) Write(b []byte) (int, error) {
+	n, err := p.file.Write(b)
+	p.size += int64(n)
+	return n, err
+}
+
+func (p *localPartialAsset) Size() int64 {
+	return p.size
+}
+
+func (p *localPartialAsset) Validator() string {
+	return p.validator
+}
+
+func (p *localPartialAsset) Reset(validator string) error {
+	if err := p.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate a file: %w", err)
+	}
+	p.size, p.readOff = 0, 0
+
+	validatorName := p.file.Name() + partValidatorSuffix
+	if validator == "" {
+		if err := os.Remove(validatorName); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove a validator file: %w", err)
+		}
+	} else if err := os.WriteFile(validatorName, []byte(validator), 0664); err != nil {
+		return fmt.Errorf("write a validator file: %w", err)
+	}
+	p.validator = validator
+
+	return nil
+}
+
+func (p *localPartialAsset) Commit() error {
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("sync a file: %w", err)
+	}
+	p.committed = true
+	if err := p.Close(); err != nil {
+		return fmt.Errorf("close a file: %w", err)
+	}
+
+	if err := os.Rename(p.file.Name(), p.name); err != nil {
+		return fmt.Errorf("rename a file (%s): %w", p.file.Name(), err)
+	}
+	if err := os.Remove(p.file.Name() + partValidatorSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove a validator file: %w", err)
+	}
+	return nil
+}
+
+func (p *localPartialAsset) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+
+	// nothing to resume, don't leave an empty file
+	if !p.committed && p.size == 0 {
+		if err := os.Remove(p.file.Name()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove an empty file: %w", err)
+		}
+		if err := os.Remove(p.file.Name() + partValidatorSuffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove a validator file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package fanbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interruptedReader returns an error after reading the content.
+type interruptedReader struct {
+	r io.Reader
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestLocalStorage_Save(t *testing.T) {
+	ctx := context.Background()
+	post := Post{
+		Title:             "title",
+		PublishedDateTime: "2022-03-15T12:00:00+09:00",
+		CreatorID:         "creator",
+	}
+	img := Image{ID: "img1", Extension: "jpeg"}
+
+	t.Run("interrupted", func(t *testing.T) {
+		s := &LocalStorage{SaveDir: t.TempDir(), DirByPost: true}
+
+		err := s.Save(ctx, post, 0, img, &interruptedReader{r: strings.NewReader("partial")})
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+		ok, err := s.Exist(ctx, post, 0, img)
+		require.NoError(t, err)
+		assert.False(t, ok, "interrupted asset should not exist")
+
+		entries, err := os.ReadDir(filepath.Join(s.SaveDir, "creator", "2022-03-15-title"))
+		require.NoError(t, err)
+		assert.Empty(t, entries, "partial file should be removed")
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		s := &LocalStorage{SaveDir: t.TempDir()}
+
+		require.NoError(t, s.Save(ctx, post, 0, img, strings.NewReader("long content")))
+		require.NoError(t, s.Save(ctx, post, 0, img, strings.NewReader("short")))
+
+		name, err := s.makeFileName(post, 0, img)
+		require.NoError(t, err)
+		b, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, "short", string(b))
+	})
+}
+
+func TestLocalStorage_Exist_OriginalFileNames(t *testing.T) {
+	ctx := context.Background()
+	files := []File{{ID: "file1", Name: "archive", Extension: "zip"}}
+	post := Post{
+		Title:             "title",
+		PublishedDateTime: "2022-03-15T12:00:00+09:00",
+		CreatorID:         "creator",
+		Body:              &PostBody{Files: &files},
+	}
+
+	dir := t.TempDir()
+	legacy := &LocalStorage{SaveDir: dir, DirByPost: true}
+	require.NoError(t, legacy.Save(ctx, post, 0, files[0], strings.NewReader("content")))
+
+	s := &LocalStorage{SaveDir: dir, DirByPost: true, OriginalFileNames: true}
+	loc, err := s.Location(post, 0, files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "creator/2022-03-15-title/archive.zip", loc)
+	exist, err := s.Exist(ctx, post, 0, files[0])
+	require.NoError(t, err)
+	assert.True(t, exist, "file saved by its ID should be detected")
+
+	loc, err = legacy.Location(post, 0, files[0])
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, filepath.FromSlash(loc))))
+	exist, err = s.Exist(ctx, post, 0, files[0])
+	require.NoError(t, err)
+	assert.False(t, exist)
+}
+
+func TestLocalStorage_RemovePartFiles(t *testing.T) {
+	s := &LocalStorage{SaveDir: t.TempDir()}
+	dir := filepath.Join(s.SaveDir, "creator")
+	require.NoError(t, os.MkdirAll(dir, 0775))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "img1.jpeg.part"), []byte("partial"), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "img2.jpeg.part.validator"), []byte(`"etag"`), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "img3.jpeg.part"), []byte("resumable"), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "img3.jpeg.part.validator"), []byte(`"etag"`), 0664))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2022-03-15-title-0-img4.jpeg"), []byte("complete"), 0664))
+
+	n, err := s.RemovePartFiles()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"2022-03-15-title-0-img4.jpeg", "img3.jpeg.part", "img3.jpeg.part.validator"}, names)
+
+	n, err = (&LocalStorage{SaveDir: filepath.Join(s.SaveDir, "not-exist")}).RemovePartFiles()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,438 @@
+package fanbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Migrator moves saved files from a layout to another layout in the same save directory.
+// Assets are recognized by IDs in their file names or paths recorded in Index,
+// and post metadata is recovered from post.json, or from GetPost if it is not found.
+// Posts of assets which are neither recorded in Index nor found by post.json are searched by ListPosts.
+type Migrator struct {
+	// From is the current layout, it is used to find rendered post documents.
+	From *LocalStorage
+	// To is the new layout, its SaveDir must be the same as From.
+	To *LocalStorage
+	// Index is optional, it helps to recognize assets, and recorded paths are updated.
+	Index DownloadIndex
+	// GetPost is optional, it gets the post whose post.json is not found.
+	GetPost func(ctx context.Context, postID string) (Post, error)
+	// ListPosts is optional, it lists posts of the creator without their bodies, see Client.ListPosts.
+	// Creators are taken from the top directories of assets, as all built-in layouts save assets into them.
+	// Listed posts are got by GetPost until the posts of all assets in the directory are found.
+	ListPosts func(ctx context.Context, creatorID string) ([]Post, error)
+	// DryRun only plans moves.
+	DryRun bool
+}
+
+// MigrationMove is a move of a file, paths are relative to the save directory.
+type MigrationMove struct {
+	From string
+	To   string
+}
+
+// MigrationConflict is a move which is not done.
+type MigrationConflict struct {
+	MigrationMove
+	Reason string
+}
+
+// MigrationResult is the result of Migrator.Run.
+type MigrationResult struct {
+	Moves     []MigrationMove
+	Conflicts []MigrationConflict
+	// Unresolved are paths of assets whose posts are unknown.
+	Unresolved []string
+}
+
+// migrationAsset is an asset file found in the save directory.
+type migrationAsset struct {
+	path   string
+	id     string
+	postID string
+	// name is the parsed file name, it is zero if the file is named by its original name.
+	name assetFileName
+}
+
+// Run moves files, or only plans moves in DryRun.
+func (m *Migrator) Run(ctx context.Context) (*MigrationResult, error) {
+	if m.From.SaveDir != m.To.SaveDir {
+		return nil, fmt.Errorf("save directories of layouts are different")
+	}
+	saveDir := m.From.SaveDir
+
+	entries, err := m.indexEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entryByPath := make(map[string]IndexEntry, len(entries))
+	postIDByAsset := make(map[string]string)
+	for _, e := range entries {
+		entryByPath[e.Path] = e
+		if e.PostID != "" {
+			postIDByAsset[e.AssetID] = e.PostID
+		}
+	}
+
+	posts := make(map[string]Post)
+	postDocs := make(map[string]string)
+	var assets []migrationAsset
+	err = filepath.WalkDir(saveDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(name, partFileSuffix) || strings.HasSuffix(name, partValidatorSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(saveDir, name)
+		if err != nil {
+			return fmt.Errorf("relative path of %s: %w", name, err)
+		}
+		rel = filepath.ToSlash(rel)
+
+		a, parsed := parseAssetFileName(d.Name())
+		if e, ok := entryByPath[rel]; ok {
+			assets = append(assets, migrationAsset{path: rel, id: e.AssetID, name: a})
+			return nil
+		}
+		if filepath.Ext(name) == ".json" {
+			if post, ok := readPostMetadata(name); ok {
+				posts[post.ID] = post
+				postDocs[post.ID] = rel
+				return nil
+			}
+		}
+		if parsed && !isPostDocumentName(d.Name(), a) {
+			assets = append(assets, migrationAsset{path: rel, id: a.ID, name: a})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", saveDir, err)
+	}
+
+	// assets of posts found by post.json
+	for _, post := range posts {
+		for _, id := range postAssetIDs(post) {
+			postIDByAsset[id] = post.ID
+		}
+	}
+
+	// assets which are neither recorded in the index nor found by post.json
+	unknownByCreator := make(map[string]map[string]bool)
+	for _, a := range assets {
+		creatorID, _, ok := strings.Cut(a.path, "/")
+		if !ok || postIDByAsset[a.id] != "" {
+			continue
+		}
+		if unknownByCreator[creatorID] == nil {
+			unknownByCreator[creatorID] = make(map[string]bool)
+		}
+		unknownByCreator[creatorID][a.id] = true
+	}
+	for creatorID, unknown := range unknownByCreator {
+		if err := m.searchPosts(ctx, creatorID, unknown, posts, postIDByAsset); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &MigrationResult{}
+	failedPosts := make(map[string]bool)
+	for i, a := range assets {
+		assets[i].postID = postIDByAsset[a.id]
+		if assets[i].postID == "" {
+			res.Unresolved = append(res.Unresolved, a.path)
+			continue
+		}
+		if _, ok := posts[assets[i].postID]; ok || m.GetPost == nil || failedPosts[assets[i].postID] {
+			continue
+		}
+
+		slog.InfoContext(ctx, "Getting metadata of the post", "post_id", assets[i].postID)
+		post, err := m.GetPost(ctx, assets[i].postID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("get post %s: %w", assets[i].postID, err)
+			}
+			// assets of the post are reported as unresolved
+			slog.ErrorContext(ctx, "Failed to get metadata of the post", "post_id", assets[i].postID, "error", err)
+			failedPosts[assets[i].postID] = true
+			continue
+		}
+		posts[post.ID] = post
+	}
+
+	var moves []MigrationMove
+	movedAssets := make(map[string]migrationAsset)
+	for _, a := range assets {
+		if a.postID == "" {
+			continue
+		}
+		post, ok := posts[a.postID]
+		if !ok {
+			res.Unresolved = append(res.Unresolved, a.path)
+			continue
+		}
+		order, d, ok := migrationDownloadable(post, a)
+		if !ok {
+			res.Unresolved = append(res.Unresolved, a.path)
+			continue
+		}
+
+		to, err := m.To.Location(post, order, d)
+		if err != nil {
+			slog.WarnContext(ctx, "Cannot decide the path of the asset", "path", a.path, "error", err)
+			res.Unresolved = append(res.Unresolved, a.path)
+			continue
+		}
+		mv := MigrationMove{From: a.path, To: to}
+		moves = append(moves, mv)
+		movedAssets[mv.From] = a
+	}
+	for postID, post := range posts {
+		for _, doc := range []struct{ name, ext string }{{"post", "json"}, {"index", "md"}, {"index", "html"}} {
+			from, err := m.From.PostDocumentLocation(post, doc.name, doc.ext)
+			if doc.ext == "json" && postDocs[postID] != "" {
+				from, err = postDocs[postID], nil
+			}
+			if err != nil || !fileExists(filepath.Join(saveDir, filepath.FromSlash(from))) {
+				continue
+			}
+			to, err := m.To.PostDocumentLocation(post, doc.name, doc.ext)
+			if err != nil {
+				slog.WarnContext(ctx, "Cannot decide the path of the post document", "path", from, "error", err)
+				continue
+			}
+			moves = append(moves, MigrationMove{From: from, To: to})
+		}
+	}
+
+	sort.Slice(moves, func(i, j int) bool { return moves[i].From < moves[j].From })
+	targets := make(map[string]int)
+	for _, mv := range moves {
+		targets[mv.To]++
+	}
+	for _, mv := range moves {
+		switch {
+		case mv.From == mv.To:
+			continue
+		case targets[mv.To] > 1:
+			res.Conflicts = append(res.Conflicts, MigrationConflict{MigrationMove: mv, Reason: "multiple files are moved to the same path"})
+			continue
+		case fileExists(filepath.Join(saveDir, filepath.FromSlash(mv.To))):
+			res.Conflicts = append(res.Conflicts, MigrationConflict{MigrationMove: mv, Reason: "the file already exists"})
+			continue
+		}
+		res.Moves = append(res.Moves, mv)
+	}
+	sort.Strings(res.Unresolved)
+
+	if m.DryRun {
+		return res, nil
+	}
+
+	for _, mv := range res.Moves {
+		if err := m.move(saveDir, mv); err != nil {
+			return res, err
+		}
+		if a, ok := movedAssets[mv.From]; ok && m.Index != nil {
+			if err := m.updateIndex(ctx, entryByPath, a, mv.To); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// searchPosts gets listed posts of the creator until the posts of unknown assets are found.
+// Found posts are added to posts and postIDByAsset.
+func (m *Migrator) searchPosts(ctx context.Context, creatorID string, unknown map[string]bool, posts map[string]Post, postIDByAsset map[string]string) error {
+	if m.ListPosts == nil || m.GetPost == nil {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "Searching posts of assets", "creator_id", creatorID, "assets", len(unknown))
+	listed, err := m.ListPosts(ctx, creatorID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("list posts of %s: %w", creatorID, err)
+		}
+		// the directory may not be of a creator, its assets are reported as unresolved
+		slog.ErrorContext(ctx, "Failed to list posts", "creator_id", creatorID, "error", err)
+		return nil
+	}
+
+	for _, item := range listed {
+		if len(unknown) == 0 {
+			break
+		}
+		if _, ok := posts[item.ID]; ok {
+			continue
+		}
+
+		post, err := m.GetPost(ctx, item.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("get post %s: %w", item.ID, err)
+			}
+			slog.ErrorContext(ctx, "Failed to get metadata of the post", "post_id", item.ID, "error", err)
+			continue
+		}
+		posts[post.ID] = post
+		for _, id := range postAssetIDs(post) {
+			postIDByAsset[id] = post.ID
+			delete(unknown, id)
+		}
+	}
+	return nil
+}
+
+// postAssetIDs returns IDs of the assets of the post, including embeds which are not downloaded by default.
+func postAssetIDs(post Post) []string {
+	var ids []string
+	for _, d := range post.ListDownloadable() {
+		ids = append(ids, d.GetID())
+	}
+	for _, b := range post.contentBlocks() {
+		if id := post.blockEmbedID(b); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (m *Migrator) indexEntries(ctx context.Context) ([]IndexEntry, error) {
+	if m.Index == nil {
+		return nil, nil
+	}
+	entries, err := m.Index.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list index entries: %w", err)
+	}
+
+	// paths of entries saved into other storages don't point to files in SaveDir
+	root := m.From.Root()
+	res := entries[:0]
+	for _, e := range entries {
+		if e.Root == "" || e.Root == root {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+// move renames the file, and removes the source directories which get empty.
+func (m *Migrator) move(saveDir string, mv MigrationMove) error {
+	from := filepath.Join(saveDir, filepath.FromSlash(mv.From))
+	to := filepath.Join(saveDir, filepath.FromSlash(mv.To))
+
+	if err := os.MkdirAll(filepath.Dir(to), 0775); err != nil {
+		return fmt.Errorf("create a directory: %w", err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("rename a file (%s): %w", mv.From, err)
+	}
+
+	for dir := path.Dir(mv.From); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if err := os.Remove(filepath.Join(saveDir, filepath.FromSlash(dir))); err != nil {
+			// not empty
+			break
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) updateIndex(ctx context.Context, entryByPath map[string]IndexEntry, a migrationAsset, to string) error {
+	e, ok := entryByPath[a.path]
+	if !ok {
+		return nil
+	}
+	e.PostID = a.postID
+	e.Path = to
+	e.Root = m.To.Root()
+	if err := m.Index.Record(ctx, &e); err != nil {
+		return fmt.Errorf("record %s: %w", to, err)
+	}
+	return nil
+}
+
+// postDocumentExtensions are extensions of documents saved by PostDocumentStorage.
+var postDocumentExtensions = map[string]bool{".json": true, ".md": true, ".html": true}
+
+// isPostDocumentName reports whether the file parsed as an asset is a post document,
+// such as "2006-01-02-title-12345.index.md", or "2006-01-02-title.md" saved by older versions in flat layouts.
+func isPostDocumentName(name string, a assetFileName) bool {
+	ext := path.Ext(name)
+	if !postDocumentExtensions[ext] {
+		return false
+	}
+	base := strings.TrimSuffix(name, ext)
+	if base == "post" || base == "index" || strings.HasSuffix(base, ".post") || strings.HasSuffix(base, ".index") {
+		return true
+	}
+	// images are never saved as documents, only files can be
+	return a.Type == "image"
+}
+
+// readPostMetadata reads post.json saved by Client, it returns false if the file is not post.json.
+func readPostMetadata(name string) (Post, bool) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return Post{}, false
+	}
+	var meta postMetadata
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return Post{}, false
+	}
+	if meta.ID == "" || meta.CreatorID == "" || meta.PublishedDateTime == "" {
+		return Post{}, false
+	}
+	return meta.Post, true
+}
+
+// migrationDownloadable returns the downloadable of the asset found in the post, or made by its file name.
+func migrationDownloadable(post Post, a migrationAsset) (int, Downloadable, bool) {
+	assets, err := (&Client{}).ListPostAssets(post)
+	if err == nil {
+		for _, pa := range assets {
+			if pa.Downloadable.GetID() != a.id {
+				continue
+			}
+			// the extension was resolved when downloading, take it from the file name
+			if e, ok := pa.Downloadable.(EmbeddedAsset); ok && e.Extension == "" {
+				if a.name.Extension == "" {
+					return 0, nil, false
+				}
+				e.Extension = a.name.Extension
+				return pa.Order, e, true
+			}
+			return pa.Order, pa.Downloadable, true
+		}
+	}
+
+	var d Downloadable
+	switch a.name.Type {
+	case "image":
+		d = Image{ID: a.id, Extension: a.name.Extension}
+	case "file":
+		d = File{ID: a.id, Extension: a.name.Extension}
+	case "embed":
+		d = EmbeddedAsset{ID: a.id, Extension: a.name.Extension}
+	default:
+		return 0, nil, false
+	}
+	return a.name.Order, d, true
+}
@@ -0,0 +1,137 @@
+package fanbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	saveDir := filepath.Join(dir, "save")
+
+	idx, err := OpenSQLiteIndex(ctx, filepath.Join(dir, "index.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, idx.Close())
+	})
+
+	from := &LocalStorage{SaveDir: saveDir}
+	to := &LocalStorage{SaveDir: saveDir, DirByPost: true}
+
+	// the article post has post.json
+	article := loadPostInfo(t, "post_info_article.json")
+	b, err := json.Marshal(postMetadata{URL: article.URL(), Post: article})
+	require.NoError(t, err)
+	require.NoError(t, from.SavePostDocument(ctx, article, "post", "json", bytes.NewReader(b)))
+	require.NoError(t, from.SavePostDocument(ctx, article, "index", "md", strings.NewReader("# article")))
+	img, _ := article.blockImage(Block{ImageID: ptr("img1")})
+	file, _ := article.blockFile(Block{FileID: ptr("file1")})
+	require.NoError(t, from.Save(ctx, article, 0, img, strings.NewReader("png")))
+	require.NoError(t, from.Save(ctx, article, 0, file, strings.NewReader("zip")))
+
+	// the text post is only recorded in the index
+	text := loadPostInfo(t, "post_info_text.json")
+	textImg := Image{ID: "textimg1", Extension: "jpeg"}
+	require.NoError(t, from.Save(ctx, text, 0, textImg, strings.NewReader("jpeg")))
+	textImgPath, err := from.Location(text, 0, textImg)
+	require.NoError(t, err)
+	require.NoError(t, idx.Record(ctx, &IndexEntry{PostID: text.ID, AssetID: textImg.ID, Path: textImgPath}))
+
+	// the post of the asset is neither recorded nor saved, it is found by listing posts of the creator
+	var listed Post
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"5","title":"listed","type":"image","publishedDatetime":"2022-03-16T10:00:00+09:00","creatorId":"creator",
+		"body":{"images":[{"id":"listedimg1","extension":"jpeg","originalUrl":"https://downloads.fanbox.cc/images/listedimg1.jpeg"}]}}`), &listed))
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "2022-03-16-listed-0-listedimg1.jpeg"), []byte("jpeg"), 0664))
+
+	// the post of the asset is unknown since the directory is not of a creator
+	require.NoError(t, os.MkdirAll(filepath.Join(saveDir, "other"), 0775))
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "other", "2022-03-16-unknown-0-unknown1.jpeg"), []byte("jpeg"), 0664))
+
+	// the post is recorded in the index, but it can't be got
+	goneImg := "creator/2022-03-16-gone-0-goneimg1.jpeg"
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, filepath.FromSlash(goneImg)), []byte("jpeg"), 0664))
+	require.NoError(t, idx.Record(ctx, &IndexEntry{PostID: "404", AssetID: "goneimg1", Path: goneImg}))
+
+	// the document saved by older versions is not an asset
+	require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "2022-03-15-part-2-legacy.md"), []byte("# legacy"), 0664))
+
+	var gotPosts []string
+	newMigrator := func(dryRun bool) *Migrator {
+		return &Migrator{
+			From:  from,
+			To:    to,
+			Index: idx,
+			GetPost: func(_ context.Context, postID string) (Post, error) {
+				gotPosts = append(gotPosts, postID)
+				switch postID {
+				case text.ID:
+					return text, nil
+				case listed.ID:
+					return listed, nil
+				}
+				return Post{}, ErrNotFound
+			},
+			ListPosts: func(_ context.Context, creatorID string) ([]Post, error) {
+				if creatorID != "creator" {
+					return nil, ErrCreatorNotFound
+				}
+				// posts after the found one are not got
+				return []Post{{ID: article.ID}, {ID: listed.ID}, {ID: "6"}}, nil
+			},
+			DryRun: dryRun,
+		}
+	}
+
+	wantMoves := []MigrationMove{
+		{From: "creator/2022-03-16-article post-0-img1.png", To: "creator/2022-03-16-article post/0-img1.png"},
+		{From: "creator/2022-03-16-article post-1000002.index.md", To: "creator/2022-03-16-article post/index.md"},
+		{From: "creator/2022-03-16-article post-1000002.post.json", To: "creator/2022-03-16-article post/post.json"},
+		{From: "creator/2022-03-16-article post-file-0-file1.zip", To: "creator/2022-03-16-article post/file-0-file1.zip"},
+		{From: "creator/2022-03-16-listed-0-listedimg1.jpeg", To: "creator/2022-03-16-listed/0-listedimg1.jpeg"},
+		{From: "creator/2022-03-16-text post-0-textimg1.jpeg", To: "creator/2022-03-16-text post/0-textimg1.jpeg"},
+	}
+
+	t.Run("dry-run", func(t *testing.T) {
+		res, err := newMigrator(true).Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, wantMoves, res.Moves)
+		assert.Empty(t, res.Conflicts)
+		assert.Equal(t, []string{goneImg, "other/2022-03-16-unknown-0-unknown1.jpeg"}, res.Unresolved)
+		assert.ElementsMatch(t, []string{"404", text.ID, listed.ID}, gotPosts, "only posts without post.json should be fetched")
+		assert.FileExists(t, filepath.Join(saveDir, "creator", "2022-03-16-article post-0-img1.png"))
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		// an existing file is not overwritten
+		require.NoError(t, os.MkdirAll(filepath.Join(saveDir, "creator", "2022-03-16-article post"), 0775))
+		require.NoError(t, os.WriteFile(filepath.Join(saveDir, "creator", "2022-03-16-article post", "index.md"), []byte("other"), 0664))
+
+		res, err := newMigrator(false).Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []MigrationConflict{{MigrationMove: wantMoves[1], Reason: "the file already exists"}}, res.Conflicts)
+		assert.Len(t, res.Moves, len(wantMoves)-1)
+
+		for _, mv := range res.Moves {
+			assert.NoFileExists(t, filepath.Join(saveDir, filepath.FromSlash(mv.From)))
+			assert.FileExists(t, filepath.Join(saveDir, filepath.FromSlash(mv.To)))
+		}
+
+		e, err := idx.Lookup(ctx, text.ID, textImg.ID)
+		require.NoError(t, err)
+		require.NotNil(t, e)
+		assert.Equal(t, "creator/2022-03-16-text post/0-textimg1.jpeg", e.Path)
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
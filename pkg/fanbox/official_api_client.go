@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"reflect"
+	"strings"
 
 	"github.com/hashicorp/go-retryablehttp"
 )
@@ -19,25 +20,48 @@ type OfficialAPIClient struct {
 	HTTPClient *retryablehttp.Client
 	Cookie     string
 	UserAgent  string
+	// RateLimiter is optional, if it is set, requests wait for it.
+	// Set RateLimiter.PrepareRetry to HTTPClient.PrepareRetry to make retries wait for it too.
+	RateLimiter *RateLimiter
 }
 
 func (c *OfficialAPIClient) Request(ctx context.Context, method string, url string) (*http.Response, error) {
+	return c.RequestWithHeader(ctx, method, url, nil)
+}
+
+// RequestWithHeader sends the request with the additional header, such as Range.
+func (c *OfficialAPIClient) RequestWithHeader(ctx context.Context, method string, url string, header http.Header) (*http.Response, error) {
 	req, err := retryablehttp.NewRequest(method, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("http request building error: %w", err)
 	}
 
 	req = req.WithContext(ctx)
-	req.Header.Set("Cookie", c.Cookie)
-	req.Header.Set("Origin", "https://www.fanbox.cc") // If Origin header is not set, FANBOX returns HTTP 400 error.
-	req.Header.Set("Referer", "https://www.fanbox.cc/")
+	// the session must not be sent to other hosts, such as hosts of embedded files
+	if isFanboxHost(req.URL.Hostname()) {
+		req.Header.Set("Cookie", c.Cookie)
+		req.Header.Set("Origin", "https://www.fanbox.cc") // If Origin header is not set, FANBOX returns HTTP 400 error.
+		req.Header.Set("Referer", "https://www.fanbox.cc/")
+	}
 	req.Header.Set("User-Agent", c.UserAgent)
 	req.Header.Set("Accept", "application/json, text/plain, */*")
 	req.Header.Set("Accept-Encoding", "gzip")
+	for k, v := range header {
+		req.Header[k] = v
+	}
 
+	if c.RateLimiter != nil {
+		if err := c.RateLimiter.Wait(ctx, req.URL); err != nil {
+			return nil, fmt.Errorf("wait for rate limit: %w", err)
+		}
+	}
 	return c.HTTPClient.Do(req)
 }
 
+func isFanboxHost(host string) bool {
+	return host == "fanbox.cc" || strings.HasSuffix(host, ".fanbox.cc")
+}
+
 func (c *OfficialAPIClient) RequestAndUnwrapJSON(ctx context.Context, method string, url string, v interface{}) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
@@ -54,7 +78,7 @@ func (c *OfficialAPIClient) RequestAndUnwrapJSON(ctx context.Context, method str
 	}()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("status is %s", resp.Status)
+		return newAPIError(resp)
 	}
 
 	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
@@ -1,5 +1,12 @@
 package fanbox
 
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+)
+
 // Pagination represents the response of https://api.fanbox.cc/post.paginateCreator?creatorId=x.
 type Pagination struct {
 	Pages []string `json:"body"`
@@ -19,31 +26,154 @@ type PostInfoResponse struct {
 type Post struct {
 	ID                string    `json:"id"`
 	Title             string    `json:"title"`
+	Type              string    `json:"type"` // image, file, article, text, video or entry.
 	PublishedDateTime string    `json:"publishedDatetime"`
+	UpdatedDateTime   string    `json:"updatedDatetime"`
 	CreatorID         string    `json:"creatorId"`
+	User              *PostUser `json:"user"`
 	FeeRequired       int       `json:"feeRequired"`
 	IsRestricted      bool      `json:"isRestricted"`
 	IsPinned          bool      `json:"isPinned"`
+	HasAdultContent   bool      `json:"hasAdultContent"`
+	Tags              []string  `json:"tags"`
+	Excerpt           string    `json:"excerpt"`
+	LikeCount         int       `json:"likeCount"`
+	CommentCount      int       `json:"commentCount"`
+	CoverImageURL     *string   `json:"coverImageUrl"`
 	Body              *PostBody `json:"body"`
 }
 
+// URL returns the URL of the post page.
+func (p *Post) URL() string {
+	return fmt.Sprintf("https://www.fanbox.cc/@%s/posts/%s", p.CreatorID, p.ID)
+}
+
+// PostUser represents the pixiv user of the creator.
+type PostUser struct {
+	UserID  string `json:"userId"`
+	Name    string `json:"name"`
+	IconURL string `json:"iconUrl"`
+}
+
 type PostBody struct {
+	// Text is the text of the post, it is not nil if post type is "image", "file", "text" or "video".
+	Text *string `json:"text"`
 	// Files is not nil if post type is "file".
 	Files *[]File `json:"files"`
 	// Images is not nil if post type is "image".
 	Images *[]Image `json:"images"`
-	// Blocks is not nil if post type is "blog".
+	// Video is not nil if post type is "video".
+	Video *PostVideo `json:"video"`
+	// Blocks is not nil if post type is "article".
 	Blocks *[]Block `json:"blocks"`
-	// ImageMap is not nil if post type is "blog".
+	// ImageMap is not nil if post type is "article".
 	ImageMap *map[string]Image `json:"imageMap"`
-	// FileMap is not nil if post type is "blog".
+	// FileMap is not nil if post type is "article".
 	FileMap *map[string]File `json:"fileMap"`
+	// EmbedMap is not nil if post type is "article".
+	EmbedMap *map[string]Embed `json:"embedMap"`
+	// URLEmbedMap is not nil if post type is "article".
+	URLEmbedMap *map[string]URLEmbed `json:"urlEmbedMap"`
 }
 
 type Block struct {
-	Type    string  `json:"type"` // p(text) or image.
-	ImageID *string `json:"imageId"`
-	FileID  *string `json:"fileId"`
+	Type       string       `json:"type"` // p(text), header, image, file, embed or url_embed.
+	Text       string       `json:"text,omitempty"`
+	Styles     []BlockStyle `json:"styles,omitempty"`
+	Links      []BlockLink  `json:"links,omitempty"`
+	ImageID    *string      `json:"imageId"`
+	FileID     *string      `json:"fileId"`
+	EmbedID    *string      `json:"embedId,omitempty"`
+	URLEmbedID *string      `json:"urlEmbedId,omitempty"`
+}
+
+// PostVideo represents the video of "video" posts, which is hosted by an external service.
+type PostVideo struct {
+	ServiceProvider string `json:"serviceProvider"` // youtube, vimeo or soundcloud.
+	VideoID         string `json:"videoId"`
+}
+
+// URL returns the URL of the video page.
+func (v PostVideo) URL() string {
+	return embedURL(v.ServiceProvider, v.VideoID)
+}
+
+// Embed represents content of an external service embedded in "article" posts.
+type Embed struct {
+	ID              string `json:"id"`
+	ServiceProvider string `json:"serviceProvider"` // youtube, vimeo, soundcloud, twitter, google_forms, gist or fanbox.
+	ContentID       string `json:"contentId"`
+}
+
+// URL returns the URL of the embedded content, or empty string if the service is unknown.
+func (e Embed) URL() string {
+	return embedURL(e.ServiceProvider, e.ContentID)
+}
+
+func embedURL(serviceProvider, contentID string) string {
+	switch serviceProvider {
+	case "youtube":
+		return "https://www.youtube.com/watch?v=" + url.QueryEscape(contentID)
+	case "vimeo":
+		return "https://vimeo.com/" + contentID
+	case "soundcloud":
+		return "https://soundcloud.com/" + contentID
+	case "twitter":
+		return "https://twitter.com/i/status/" + contentID
+	case "google_forms":
+		return "https://docs.google.com/forms/d/e/" + contentID + "/viewform"
+	case "gist":
+		return "https://gist.github.com/" + contentID
+	}
+	return ""
+}
+
+// URLEmbed represents a URL embedded in "article" posts.
+type URLEmbed struct {
+	ID       string            `json:"id"`
+	Type     string            `json:"type"` // default, html, html.card, fanbox.post or fanbox.creator.
+	URL      string            `json:"url,omitempty"`
+	Host     string            `json:"host,omitempty"`
+	HTML     string            `json:"html,omitempty"`
+	PostInfo *URLEmbedPostInfo `json:"postInfo,omitempty"`
+}
+
+// URLEmbedPostInfo is the FANBOX post of "fanbox.post" URL embeds.
+type URLEmbedPostInfo struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	CreatorID string `json:"creatorId"`
+}
+
+var iframeSrcRegexp = regexp.MustCompile(`src="([^"]+)"`)
+
+// GetURL returns the embedded URL, or empty string if it is unknown.
+func (e URLEmbed) GetURL() string {
+	switch {
+	case e.URL != "":
+		return e.URL
+	case e.PostInfo != nil:
+		return (&Post{ID: e.PostInfo.ID, CreatorID: e.PostInfo.CreatorID}).URL()
+	}
+	// "html" and "html.card" types have an iframe
+	if m := iframeSrcRegexp.FindStringSubmatch(e.HTML); m != nil {
+		return html.UnescapeString(m[1])
+	}
+	return ""
+}
+
+// BlockStyle is the style of a range of the block text.
+type BlockStyle struct {
+	Type   string `json:"type"` // bold
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// BlockLink is the link of a range of the block text.
+type BlockLink struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url"`
 }
 
 type Downloadable interface {
@@ -101,7 +231,26 @@ func (i Image) GetExtension() string {
 	return i.Extension
 }
 
+// knownPostTypes are post types which are handled by ListDownloadable.
+var knownPostTypes = map[string]bool{
+	"image":   true,
+	"file":    true,
+	"article": true,
+	"text":    true,
+	"video":   true,
+	"entry":   true,
+}
+
+// IsKnownType reports whether the post type is known, content of unknown types may not be downloaded.
+func (f *Post) IsKnownType() bool {
+	return knownPostTypes[f.Type]
+}
+
 func (f *Post) ListDownloadable() []Downloadable {
+	if f.Body == nil {
+		return nil
+	}
+
 	if f.Body.Images != nil {
 		res := make([]Downloadable, 0, len(*f.Body.Images))
 		for _, v := range *f.Body.Images {
@@ -121,24 +270,146 @@ func (f *Post) ListDownloadable() []Downloadable {
 	if f.Body.Blocks != nil {
 		res := make([]Downloadable, 0)
 		for _, v := range *f.Body.Blocks {
-			if v.ImageID != nil {
-				res = append(res, (*f.Body.ImageMap)[*v.ImageID])
+			if img, ok := f.blockImage(v); ok {
+				res = append(res, img)
 			}
-			if v.FileID != nil {
-				res = append(res, (*f.Body.FileMap)[*v.FileID])
+			if file, ok := f.blockFile(v); ok {
+				res = append(res, file)
 			}
 		}
 		return res
 	}
 
+	// "text" and "video" posts don't have downloadable assets
 	return nil
 }
 
+// ListDownloadableWith returns the downloadable assets including EmbeddedAsset of embeds
+// which are supported by the extractors, after the assets of ListDownloadable.
+func (f *Post) ListDownloadableWith(r *ExtractorRegistry) []Downloadable {
+	res := f.ListDownloadable()
+	if r == nil {
+		return res
+	}
+
+	for _, b := range f.contentBlocks() {
+		id := f.blockEmbedID(b)
+		if id == "" {
+			continue
+		}
+		if a, ok := r.Extract(id, f.blockEmbedURL(b)); ok {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// contentBlocks returns the content of the post as blocks, to render all types of posts in the same way.
+func (f *Post) contentBlocks() []Block {
+	if f.Body == nil {
+		return nil
+	}
+	if f.Body.Blocks != nil {
+		return *f.Body.Blocks
+	}
+
+	var res []Block
+	if f.Body.Video != nil {
+		res = append(res, Block{Type: "video"})
+	}
+	for _, d := range f.ListDownloadable() {
+		id := d.GetID()
+		switch d.(type) {
+		case Image:
+			res = append(res, Block{Type: "image", ImageID: &id})
+		case File:
+			res = append(res, Block{Type: "file", FileID: &id})
+		}
+	}
+	if f.Body.Text != nil && *f.Body.Text != "" {
+		res = append(res, Block{Type: "p", Text: *f.Body.Text})
+	}
+	return res
+}
+
+// blockImage returns the image of the "image" block.
+func (f *Post) blockImage(b Block) (Image, bool) {
+	if b.ImageID == nil {
+		return Image{}, false
+	}
+	if f.Body.ImageMap != nil {
+		img, ok := (*f.Body.ImageMap)[*b.ImageID]
+		return img, ok
+	}
+	if f.Body.Images != nil {
+		for _, img := range *f.Body.Images {
+			if img.ID == *b.ImageID {
+				return img, true
+			}
+		}
+	}
+	return Image{}, false
+}
+
+// blockFile returns the file of the "file" block.
+func (f *Post) blockFile(b Block) (File, bool) {
+	if b.FileID == nil {
+		return File{}, false
+	}
+	if f.Body.FileMap != nil {
+		file, ok := (*f.Body.FileMap)[*b.FileID]
+		return file, ok
+	}
+	if f.Body.Files != nil {
+		for _, file := range *f.Body.Files {
+			if file.ID == *b.FileID {
+				return file, true
+			}
+		}
+	}
+	return File{}, false
+}
+
+// blockEmbedID returns the ID of the "embed", "url_embed" or "video" block, or empty string if it is not an embed.
+// Video posts have only one video, so its ID is made from the post ID.
+func (f *Post) blockEmbedID(b Block) string {
+	switch {
+	case b.EmbedID != nil:
+		return *b.EmbedID
+	case b.URLEmbedID != nil:
+		return *b.URLEmbedID
+	case b.Type == "video" && f.Body.Video != nil:
+		return "video" + f.ID
+	}
+	return ""
+}
+
+// blockEmbedURL returns the URL of the "embed" or "url_embed" block, or empty string if it is unknown.
+func (f *Post) blockEmbedURL(b Block) string {
+	if b.EmbedID != nil && f.Body.EmbedMap != nil {
+		if e, ok := (*f.Body.EmbedMap)[*b.EmbedID]; ok {
+			return e.URL()
+		}
+	}
+	if b.URLEmbedID != nil && f.Body.URLEmbedMap != nil {
+		if e, ok := (*f.Body.URLEmbedMap)[*b.URLEmbedID]; ok {
+			return e.GetURL()
+		}
+	}
+	if b.Type == "video" && f.Body.Video != nil {
+		return f.Body.Video.URL()
+	}
+	return ""
+}
+
 type PlanListSupportingResponse struct {
 	Body []Plan `json:"body"`
 }
 
 type Plan struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Fee       int    `json:"fee"`
 	CreatorID string `json:"creatorId"`
 }
 
@@ -147,5 +418,11 @@ type CreatorListFollowingResponse struct {
 }
 
 type Creator struct {
-	CreatorID string `json:"creatorId"`
+	CreatorID string    `json:"creatorId"`
+	User      *PostUser `json:"user,omitempty"`
+}
+
+// CreatorGetResponse represents the response of https://api.fanbox.cc/creator.get.
+type CreatorGetResponse struct {
+	Body Creator `json:"body"`
 }
@@ -0,0 +1,71 @@
+package fanbox
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPostInfo(t *testing.T, name string) Post {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	var resp PostInfoResponse
+	require.NoError(t, json.Unmarshal(b, &resp))
+	return resp.Body
+}
+
+func TestPost_ListDownloadable(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		post := loadPostInfo(t, "post_info_text.json")
+		assert.True(t, post.IsKnownType())
+		assert.Empty(t, post.ListDownloadable())
+		assert.Equal(t, []Block{{Type: "p", Text: "first line\nsecond line"}}, post.contentBlocks())
+	})
+
+	t.Run("article", func(t *testing.T) {
+		post := loadPostInfo(t, "post_info_article.json")
+		assert.True(t, post.IsKnownType())
+
+		var ids []string
+		for _, d := range post.ListDownloadable() {
+			ids = append(ids, d.GetID())
+		}
+		assert.Equal(t, []string{"img1", "file1"}, ids)
+
+		var embeds []string
+		for _, b := range post.contentBlocks() {
+			if b.Type == "embed" || b.Type == "url_embed" {
+				embeds = append(embeds, post.blockEmbedURL(b))
+			}
+		}
+		assert.Equal(t, []string{
+			"https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			"https://www.dropbox.com/s/abc/archive.zip?dl=0",
+			"https://drive.google.com/file/d/DRIVEID/view?usp=sharing&x=1",
+			"https://www.fanbox.cc/@creator/posts/1000001",
+		}, embeds)
+	})
+
+	t.Run("video", func(t *testing.T) {
+		post := loadPostInfo(t, "post_info_video.json")
+		assert.True(t, post.IsKnownType())
+		assert.Empty(t, post.ListDownloadable())
+
+		blocks := post.contentBlocks()
+		require.Len(t, blocks, 2)
+		assert.Equal(t, "https://vimeo.com/76979871", post.blockEmbedURL(blocks[0]))
+		assert.Equal(t, "my video", blocks[1].Text)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		post := Post{Type: "poll", Body: &PostBody{}}
+		assert.False(t, post.IsKnownType())
+		assert.Empty(t, post.ListDownloadable())
+	})
+}
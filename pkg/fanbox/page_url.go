@@ -0,0 +1,116 @@
+package fanbox
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PostRef is a post referred by its page URL.
+type PostRef struct {
+	CreatorID string
+	PostID    string
+}
+
+var (
+	creatorIDPattern = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+	postIDPattern    = regexp.MustCompile(`^\d+$`)
+)
+
+// ParsePostURL parses the URL of a post page,
+// such as https://creator.fanbox.cc/posts/123 and https://www.fanbox.cc/@creator/posts/123.
+func ParsePostURL(s string) (PostRef, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return PostRef{}, fmt.Errorf("parse %q: %w", s, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return PostRef{}, fmt.Errorf("%q is not a URL of a FANBOX post", s)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	var ref PostRef
+	switch {
+	case host == "www.fanbox.cc" || host == "fanbox.cc":
+		// /@creator/posts/123
+		if len(segs) == 3 && strings.HasPrefix(segs[0], "@") && segs[1] == "posts" {
+			ref = PostRef{CreatorID: strings.TrimPrefix(segs[0], "@"), PostID: segs[2]}
+		}
+	case isFanboxHost(host):
+		// creator.fanbox.cc/posts/123
+		if len(segs) == 2 && segs[0] == "posts" {
+			ref = PostRef{CreatorID: strings.TrimSuffix(host, ".fanbox.cc"), PostID: segs[1]}
+		}
+	}
+	if !creatorIDPattern.MatchString(ref.CreatorID) || !postIDPattern.MatchString(ref.PostID) {
+		return PostRef{}, fmt.Errorf("%q is not a URL of a FANBOX post", s)
+	}
+	return ref, nil
+}
+
+// CreatorRef is a creator referred by the user input, either of the fields is set.
+type CreatorRef struct {
+	CreatorID string
+	// PixivUserID is the pixiv user ID of the creator, which needs to be resolved into the creator ID.
+	PixivUserID string
+}
+
+var pixivUserPathPattern = regexp.MustCompile(`^/(?:[a-z]{2}/)?(?:users|member\.php|fanbox/creator)(?:/(\d+))?`)
+
+// ParseCreatorInput parses the creator ID, "@" prefixed creator ID, pixiv user ID (digits),
+// or URLs of the creator page such as https://www.fanbox.cc/@creator, https://creator.fanbox.cc/
+// and https://www.pixiv.net/users/123.
+// "@" forces digits to be a creator ID, otherwise CreatorIDLister.Resolve falls back to a creator ID
+// if no creator has the pixiv user ID.
+func ParseCreatorInput(s string) (CreatorRef, error) {
+	s = strings.TrimSpace(s)
+	invalid := fmt.Errorf("%q is neither a creator ID, pixiv user ID nor URL of a creator", s)
+
+	if id, ok := strings.CutPrefix(s, "@"); ok {
+		if !creatorIDPattern.MatchString(id) {
+			return CreatorRef{}, invalid
+		}
+		return CreatorRef{CreatorID: id}, nil
+	}
+	if postIDPattern.MatchString(s) {
+		return CreatorRef{PixivUserID: s}, nil
+	}
+	if creatorIDPattern.MatchString(s) {
+		return CreatorRef{CreatorID: s}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return CreatorRef{}, invalid
+	}
+	host := strings.ToLower(u.Hostname())
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	var ref CreatorRef
+	switch {
+	case host == "www.fanbox.cc" || host == "fanbox.cc":
+		if id, ok := strings.CutPrefix(segs[0], "@"); ok {
+			ref.CreatorID = id
+		}
+	case host == "api.fanbox.cc" || host == "downloads.fanbox.cc":
+	case isFanboxHost(host):
+		ref.CreatorID = strings.TrimSuffix(host, ".fanbox.cc")
+	case host == "www.pixiv.net" || host == "pixiv.net":
+		if m := pixivUserPathPattern.FindStringSubmatch(u.Path); m != nil {
+			ref.PixivUserID = m[1]
+			if ref.PixivUserID == "" {
+				// https://www.pixiv.net/member.php?id=123
+				ref.PixivUserID = u.Query().Get("id")
+			}
+		}
+		if !postIDPattern.MatchString(ref.PixivUserID) {
+			return CreatorRef{}, invalid
+		}
+		return ref, nil
+	}
+	if !creatorIDPattern.MatchString(ref.CreatorID) {
+		return CreatorRef{}, invalid
+	}
+	return ref, nil
+}
@@ -0,0 +1,117 @@
+package fanbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePostURL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PostRef
+		wantErr bool
+	}{
+		{in: "https://creator.fanbox.cc/posts/123", want: PostRef{CreatorID: "creator", PostID: "123"}},
+		{in: "https://Creator-1.fanbox.cc/posts/123/?utm_source=x#top", want: PostRef{CreatorID: "creator-1", PostID: "123"}},
+		{in: "https://www.fanbox.cc/@creator/posts/123", want: PostRef{CreatorID: "creator", PostID: "123"}},
+		{in: " https://fanbox.cc/@creator_1/posts/123 ", want: PostRef{CreatorID: "creator_1", PostID: "123"}},
+		{in: "https://www.fanbox.cc/@creator", wantErr: true},
+		{in: "https://creator.fanbox.cc/posts/abc", wantErr: true},
+		{in: "https://creator.fanbox.cc/", wantErr: true},
+		{in: "https://www.fanbox.cc/posts/123", wantErr: true},
+		{in: "https://example.com/posts/123", wantErr: true},
+		{in: "creator.fanbox.cc/posts/123", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePostURL(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient_RunPosts(t *testing.T) {
+	client := &Client{
+		OfficialAPIClient: newFakeAPIClient(t, fakeAPI{
+			"/post.info?postId=1": `{"body":{"id":"1","title":"restricted","type":"image","publishedDatetime":"2022-03-18T01:00:00+09:00","creatorId":"creator","feeRequired":500,"isRestricted":true,"body":null}}`,
+			"/post.info?postId=2": `{"body":{"id":"2","title":"images","type":"image","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator",
+				"body":{"images":[{"id":"img1","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img1.png"}]}
+			}}`,
+			"/images/img1.png": "png1",
+		}),
+		Storage: &LocalStorage{SaveDir: t.TempDir()},
+	}
+
+	s, err := client.RunPosts(context.Background(), "creator", []string{"1", "2", "2"})
+	require.NoError(t, err)
+	assert.Equal(t, &RunSummary{
+		CreatorID:              "creator",
+		PostsScanned:           3,
+		RestrictedPostsSkipped: 1,
+		AssetsDownloaded:       1,
+		BytesDownloaded:        4,
+		AlreadyPresent:         1,
+	}, s)
+
+	// a deleted post is skipped, the creator exists
+	s, err = client.RunPosts(context.Background(), "creator", []string{"3"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), s.Errors)
+
+	// the post is not of the creator in the URL
+	_, err = client.RunPosts(context.Background(), "other", []string{"2"})
+	assert.ErrorIs(t, err, errCreatorMismatch)
+
+	client.SkipOnError = true
+	s, err = client.RunPosts(context.Background(), "other", []string{"2"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), s.Errors)
+	assert.Equal(t, int64(0), s.PostsScanned)
+}
+
+func TestParseCreatorInput(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CreatorRef
+		wantErr bool
+	}{
+		{in: "creator", want: CreatorRef{CreatorID: "creator"}},
+		{in: "@creator", want: CreatorRef{CreatorID: "creator"}},
+		{in: "@12345", want: CreatorRef{CreatorID: "12345"}},
+		{in: "12345", want: CreatorRef{PixivUserID: "12345"}},
+		{in: "https://www.fanbox.cc/@creator", want: CreatorRef{CreatorID: "creator"}},
+		{in: "https://www.fanbox.cc/@creator/posts/123", want: CreatorRef{CreatorID: "creator"}},
+		{in: "https://creator.fanbox.cc/", want: CreatorRef{CreatorID: "creator"}},
+		{in: "https://creator.fanbox.cc/plans", want: CreatorRef{CreatorID: "creator"}},
+		{in: "https://www.pixiv.net/users/12345", want: CreatorRef{PixivUserID: "12345"}},
+		{in: "https://www.pixiv.net/en/users/12345/artworks", want: CreatorRef{PixivUserID: "12345"}},
+		{in: "https://www.pixiv.net/fanbox/creator/12345", want: CreatorRef{PixivUserID: "12345"}},
+		{in: "https://www.pixiv.net/member.php?id=12345", want: CreatorRef{PixivUserID: "12345"}},
+		{in: "", wantErr: true},
+		{in: "@", wantErr: true},
+		{in: "https://www.fanbox.cc/", wantErr: true},
+		{in: "https://api.fanbox.cc/post.info", wantErr: true},
+		{in: "https://www.pixiv.net/artworks/123", wantErr: true},
+		{in: "https://example.com/@creator", wantErr: true},
+		{in: "creator name", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseCreatorInput(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package fanbox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PathTemplateData is the data passed to path templates.
+// "/" in the result separates directories, and each path segment is limited for OS safely.
+type PathTemplateData struct {
+	CreatorID string
+	PostID    string
+	// Title is the post title escaped to be used in file names.
+	Title       string
+	PublishedAt time.Time
+	FeeRequired int
+
+	// Order is the order of the asset within its type in the post.
+	Order   int
+	AssetID string
+	// AssetType is "image", "file" or "embed".
+	AssetType string
+	// OriginalName is the uploaded file name without the extension, it is empty except for files.
+	// The asset ID is appended if another file of the post has the same name.
+	OriginalName string
+	// UseOriginalName is whether the file should be named by OriginalName, by the original file names option.
+	UseOriginalName bool
+	Extension       string
+
+	// Name is the name of the post document such as "post" and "index", it is empty for assets.
+	Name string
+}
+
+// PathTemplate decides paths of assets and post documents by text/template.
+type PathTemplate struct {
+	asset    *template.Template
+	document *template.Template
+}
+
+const (
+	presetPostName  = `{{.PublishedAt.Format "2006-01-02"}}-{{.Title}}`
+	presetAssetName = `{{if .UseOriginalName}}{{.OriginalName}}{{else}}{{if ne .AssetType "image"}}{{.AssetType}}-{{end}}{{.Order}}-{{.AssetID}}{{end}}.{{.Extension}}`
+	presetPlanDir   = `{{.FeeRequired}}yen/`
+	// presetFlatDocumentName names documents beside assets, the post ID keeps posts of the same title and date apart.
+	// The document name is separated by "." not to be parsed as an asset by parseAssetFileName.
+	presetFlatDocumentName = presetPostName + `-{{.PostID}}.{{.Name}}.{{.Extension}}`
+
+	// DefaultPostDocumentTemplate is the template of post documents used with custom asset templates,
+	// documents are saved into the post directory.
+	DefaultPostDocumentTemplate = `{{.CreatorID}}/` + presetPostName + `/{{.Name}}.{{.Extension}}`
+)
+
+// pathTemplatePresets are the layouts made by DirByPost and DirByPlan options.
+var pathTemplatePresets = map[string]*PathTemplate{
+	// [CreatorID]/2006-01-02-[Post Title]-[Order]-[ID].[Extension]
+	"flat": mustParsePathTemplate(
+		`{{.CreatorID}}/`+presetPostName+`-`+presetAssetName,
+		`{{.CreatorID}}/`+presetFlatDocumentName,
+	),
+	// [CreatorID]/2006-01-02-[Post Title]/[Order]-[ID].[Extension]
+	"dir-by-post": mustParsePathTemplate(
+		`{{.CreatorID}}/`+presetPostName+`/`+presetAssetName,
+		DefaultPostDocumentTemplate,
+	),
+	// [CreatorID]/[Fee]yen/2006-01-02-[Post Title]-[Order]-[ID].[Extension]
+	"dir-by-plan": mustParsePathTemplate(
+		`{{.CreatorID}}/`+presetPlanDir+presetPostName+`-`+presetAssetName,
+		`{{.CreatorID}}/`+presetPlanDir+presetFlatDocumentName,
+	),
+	// [CreatorID]/[Fee]yen/2006-01-02-[Post Title]/[Order]-[ID].[Extension]
+	"dir-by-plan-and-post": mustParsePathTemplate(
+		`{{.CreatorID}}/`+presetPlanDir+presetPostName+`/`+presetAssetName,
+		`{{.CreatorID}}/`+presetPlanDir+presetPostName+`/{{.Name}}.{{.Extension}}`,
+	),
+}
+
+// PathTemplatePresetNames returns the names of the preset path templates.
+func PathTemplatePresetNames() []string {
+	names := make([]string, 0, len(pathTemplatePresets))
+	for name := range pathTemplatePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPathTemplate returns the preset if asset is a preset name, otherwise it parses asset and document templates.
+// If document is not empty, it replaces the document template of the preset.
+// If document is empty for a custom asset template, DefaultPostDocumentTemplate is used.
+func NewPathTemplate(asset, document string) (*PathTemplate, error) {
+	if t, ok := pathTemplatePresets[asset]; ok {
+		if document == "" {
+			return t, nil
+		}
+		// templates are named by their sources
+		asset = t.asset.Name()
+	}
+	if document == "" {
+		document = DefaultPostDocumentTemplate
+	}
+	return parsePathTemplate(asset, document)
+}
+
+func mustParsePathTemplate(asset, document string) *PathTemplate {
+	t, err := parsePathTemplate(asset, document)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parsePathTemplate(asset, document string) (*PathTemplate, error) {
+	at, err := template.New(asset).Option("missingkey=error").Parse(asset)
+	if err != nil {
+		return nil, fmt.Errorf("parse asset path template: %w", err)
+	}
+	dt, err := template.New(document).Option("missingkey=error").Parse(document)
+	if err != nil {
+		return nil, fmt.Errorf("parse post document path template: %w", err)
+	}
+
+	// execute with sample data to report unknown fields here, not while downloading
+	sample := PathTemplateData{
+		CreatorID:   "creator",
+		PostID:      "1",
+		Title:       "title",
+		PublishedAt: time.Now(),
+		AssetID:     "id",
+		AssetType:   "image",
+		Extension:   "jpeg",
+		Name:        "post",
+	}
+	for _, t := range []*template.Template{at, dt} {
+		var b strings.Builder
+		if err := t.Execute(&b, sample); err != nil {
+			return nil, fmt.Errorf("execute path template %q: %w", t.Name(), err)
+		}
+		if strings.Trim(b.String(), "/") == "" {
+			return nil, fmt.Errorf("path template %q results in an empty path", t.Name())
+		}
+	}
+
+	return &PathTemplate{asset: at, document: dt}, nil
+}
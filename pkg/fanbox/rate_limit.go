@@ -0,0 +1,133 @@
+package fanbox
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"golang.org/x/time/rate"
+)
+
+// maxRetryAfter caps waiting by Retry-After, not to hang on an unreasonable value.
+const maxRetryAfter = 10 * time.Minute
+
+// RateLimiter paces requests to FANBOX with token buckets,
+// which have separate budgets for FANBOX pages such as api.fanbox.cc and assets such as downloads.fanbox.cc.
+// A budget is also paused while FANBOX asks to retry after a while by 429 or 503 responses.
+type RateLimiter struct {
+	api      *rate.Limiter
+	download *rate.Limiter
+
+	mu          sync.Mutex
+	pausedUntil map[*rate.Limiter]time.Time
+}
+
+// NewRateLimiter returns the rate limiter which allows the requests per second.
+// If a rate is not positive, the requests are not limited.
+func NewRateLimiter(apiRPS, downloadRPS float64) *RateLimiter {
+	return &RateLimiter{
+		api:         newLimiter(apiRPS),
+		download:    newLimiter(downloadRPS),
+		pausedUntil: make(map[*rate.Limiter]time.Time),
+	}
+}
+
+func newLimiter(rps float64) *rate.Limiter {
+	if rps <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(rps), int(math.Max(1, math.Ceil(rps))))
+}
+
+// limiter returns the budget of the URL, assets are on downloads.fanbox.cc or hosts of embedded files.
+func (l *RateLimiter) limiter(u *url.URL) *rate.Limiter {
+	if host := u.Hostname(); host == "downloads.fanbox.cc" || !isFanboxHost(host) {
+		return l.download
+	}
+	return l.api
+}
+
+// Wait blocks until the request to the URL is allowed.
+func (l *RateLimiter) Wait(ctx context.Context, u *url.URL) error {
+	lim := l.limiter(u)
+
+	l.mu.Lock()
+	until := l.pausedUntil[lim]
+	l.mu.Unlock()
+	if d := time.Until(until); d > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+	return lim.Wait(ctx)
+}
+
+// PrepareRetry is retryablehttp.PrepareRetry which waits for the budget before retries of the request,
+// since OfficialAPIClient waits only before the first attempt.
+func (l *RateLimiter) PrepareRetry(req *http.Request) error {
+	return l.Wait(req.Context(), req.URL)
+}
+
+// pause pauses the budget of the URL for the duration.
+func (l *RateLimiter) pause(u *url.URL, d time.Duration) {
+	lim := l.limiter(u)
+	until := time.Now().Add(d)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.pausedUntil[lim]) {
+		l.pausedUntil[lim] = until
+	}
+}
+
+// Backoff is retryablehttp.Backoff which honors Retry-After of 429 and 503 responses,
+// and pauses the budget of the request until then, so that other requests wait too.
+// Otherwise it falls back to retryablehttp.DefaultBackoff.
+func (l *RateLimiter) Backoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+	}
+
+	wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		wait = retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	if resp.Request != nil {
+		slog.WarnContext(resp.Request.Context(), "Rate limited, waiting before the next request",
+			"status", resp.StatusCode, "host", resp.Request.URL.Hostname(), "wait", wait)
+		l.pause(resp.Request.URL, wait)
+	}
+	return wait
+}
+
+// retryAfter parses the value of Retry-After header, which is seconds or an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
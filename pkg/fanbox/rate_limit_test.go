@@ -0,0 +1,126 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{in: "", wantOK: false},
+		{in: "120", want: 2 * time.Minute, wantOK: true},
+		{in: "-1", wantOK: false},
+		{in: "Mon, 01 Jan 2024 00:00:30 GMT", want: 30 * time.Second, wantOK: true},
+		{in: "Sun, 31 Dec 2023 23:59:00 GMT", want: 0, wantOK: true},
+		{in: "soon", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.in, now)
+		assert.Equal(t, tt.wantOK, ok, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestRateLimiter_Backoff(t *testing.T) {
+	l := NewRateLimiter(0, 0)
+	apiURL, _ := url.Parse("https://api.fanbox.cc/post.info?postId=1")
+	downloadURL, _ := url.Parse("https://downloads.fanbox.cc/images/1.png")
+
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"1"}},
+		Request:    (&http.Request{URL: apiURL}).WithContext(context.Background()),
+	}
+	assert.Equal(t, time.Second, l.Backoff(time.Millisecond, time.Millisecond, 0, resp))
+
+	// the API budget is paused, but the download budget isn't
+	start := time.Now()
+	require.NoError(t, l.Wait(context.Background(), downloadURL))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	require.NoError(t, l.Wait(context.Background(), apiURL))
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+
+	// other statuses fall back to the default backoff
+	resp.StatusCode = http.StatusInternalServerError
+	assert.Equal(t, time.Millisecond, l.Backoff(time.Millisecond, time.Millisecond, 0, resp))
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	l := NewRateLimiter(20, 0)
+	apiURL, _ := url.Parse("https://api.fanbox.cc/post.info?postId=1")
+
+	start := time.Now()
+	for range 41 {
+		require.NoError(t, l.Wait(context.Background(), apiURL))
+	}
+	// 20 requests are allowed by the burst, and 21 requests take a second
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, l.Wait(ctx, apiURL))
+}
+
+func TestRateLimiter_limiter(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	for rawURL, want := range map[string]*rate.Limiter{
+		"https://api.fanbox.cc/post.info?postId=1":       l.api,
+		"https://www.fanbox.cc/@creator/posts/1":         l.api,
+		"https://creator.fanbox.cc/posts/1":              l.api,
+		"https://downloads.fanbox.cc/images/1.png":       l.download,
+		"https://www.dropbox.com/s/abc/archive.zip?dl=1": l.download,
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Same(t, want, l.limiter(u), rawURL)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimiter_PrepareRetry(t *testing.T) {
+	var requests atomic.Int32
+	api := &OfficialAPIClient{HTTPClient: retryablehttp.NewClient(), RateLimiter: NewRateLimiter(1, 0)}
+	api.HTTPClient.Logger = nil
+	api.HTTPClient.RetryMax = 1
+	api.HTTPClient.RetryWaitMin = time.Millisecond
+	api.HTTPClient.RetryWaitMax = time.Millisecond
+	api.HTTPClient.PrepareRetry = api.RateLimiter.PrepareRetry
+	api.HTTPClient.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	})
+
+	start := time.Now()
+	resp, err := api.Request(context.Background(), http.MethodGet, "https://api.fanbox.cc/post.info?postId=1")
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+	// the retry waits for the next token
+	assert.Equal(t, int32(2), requests.Load())
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
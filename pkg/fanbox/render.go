@@ -0,0 +1,196 @@
+package fanbox
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+)
+
+// assetLinker returns the link to the saved asset, relative to the rendered document.
+type assetLinker func(d Downloadable) string
+
+// safeLinkURL returns the URL if it is safe to be linked from documents,
+// only http, https and relative URLs are allowed not to run scripts such as "javascript:" URLs.
+func safeLinkURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		return v
+	}
+	return ""
+}
+
+// textSegment is a part of the block text which has the same style.
+type textSegment struct {
+	Text string
+	Bold bool
+	URL  string
+}
+
+// splitBlockText splits the block text by its styles and links.
+// Offsets and lengths of them are counted in UTF-16 code units like JavaScript.
+func splitBlockText(b Block) []textSegment {
+	units := utf16.Encode([]rune(b.Text))
+
+	bounds := map[int]struct{}{0: {}, len(units): {}}
+	for _, s := range b.Styles {
+		bounds[s.Offset] = struct{}{}
+		bounds[s.Offset+s.Length] = struct{}{}
+	}
+	for _, l := range b.Links {
+		bounds[l.Offset] = struct{}{}
+		bounds[l.Offset+l.Length] = struct{}{}
+	}
+
+	var res []textSegment
+	for start := 0; start < len(units); {
+		end := len(units)
+		for p := range bounds {
+			if p > start && p < end {
+				end = p
+			}
+		}
+
+		seg := textSegment{Text: string(utf16.Decode(units[start:end]))}
+		for _, s := range b.Styles {
+			if s.Type == "bold" && s.Offset <= start && end <= s.Offset+s.Length {
+				seg.Bold = true
+			}
+		}
+		for _, l := range b.Links {
+			if l.Offset <= start && end <= l.Offset+l.Length {
+				// unsafe links are rendered as plain texts
+				seg.URL = safeLinkURL(l.URL)
+			}
+		}
+
+		// merge with the previous segment if the style is the same
+		if n := len(res); n > 0 && res[n-1].Bold == seg.Bold && res[n-1].URL == seg.URL {
+			res[n-1].Text += seg.Text
+		} else {
+			res = append(res, seg)
+		}
+		start = end
+	}
+	return res
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+// markdownURLEscaper escapes URLs in "<>" of Markdown links.
+var markdownURLEscaper = strings.NewReplacer("<", "%3C", ">", "%3E", "\n", "%0A")
+
+func renderMarkdownText(b Block) string {
+	var sb strings.Builder
+	for _, seg := range splitBlockText(b) {
+		t := markdownEscaper.Replace(seg.Text)
+		if seg.Bold && strings.TrimSpace(t) != "" {
+			t = "**" + t + "**"
+		}
+		if seg.URL != "" {
+			t = fmt.Sprintf("[%s](<%s>)", t, markdownURLEscaper.Replace(seg.URL))
+		}
+		sb.WriteString(t)
+	}
+	// keep line breaks in a paragraph
+	return strings.ReplaceAll(sb.String(), "\n", "  \n")
+}
+
+func renderHTMLText(b Block) string {
+	var sb strings.Builder
+	for _, seg := range splitBlockText(b) {
+		t := html.EscapeString(seg.Text)
+		if seg.Bold {
+			t = "<b>" + t + "</b>"
+		}
+		if seg.URL != "" {
+			t = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(seg.URL), t)
+		}
+		sb.WriteString(t)
+	}
+	return strings.ReplaceAll(sb.String(), "\n", "<br>\n")
+}
+
+// renderPostMarkdown renders the post into a standalone Markdown document.
+func renderPostMarkdown(post Post, link assetLinker) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", markdownEscaper.Replace(post.Title))
+	fmt.Fprintf(&sb, "- Published: %s\n", post.PublishedDateTime)
+	fmt.Fprintf(&sb, "- URL: <%s>\n", post.URL())
+	if len(post.Tags) > 0 {
+		fmt.Fprintf(&sb, "- Tags: %s\n", markdownEscaper.Replace(strings.Join(post.Tags, ", ")))
+	}
+
+	for _, b := range post.contentBlocks() {
+		sb.WriteString("\n")
+		switch b.Type {
+		case "p":
+			sb.WriteString(renderMarkdownText(b) + "\n")
+		case "header":
+			sb.WriteString("## " + renderMarkdownText(b) + "\n")
+		case "image":
+			if img, ok := post.blockImage(b); ok {
+				fmt.Fprintf(&sb, "![](<%s>)\n", markdownURLEscaper.Replace(link(img)))
+			}
+		case "file":
+			if f, ok := post.blockFile(b); ok {
+				fmt.Fprintf(&sb, "[%s](<%s>)\n", markdownEscaper.Replace(f.Name+"."+f.Extension), markdownURLEscaper.Replace(link(f)))
+			}
+		default:
+			u := safeLinkURL(post.blockEmbedURL(b))
+			if u == "" {
+				u = post.URL()
+			}
+			fmt.Fprintf(&sb, "[Embedded content](<%s>)\n", markdownURLEscaper.Replace(u))
+		}
+	}
+	return sb.String()
+}
+
+// renderPostHTML renders the post into a standalone HTML document.
+func renderPostHTML(post Post, link assetLinker) string {
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(post.Title))
+	sb.WriteString("<style>body{max-width:800px;margin:0 auto;padding:16px;line-height:1.7}img{max-width:100%}</style>\n")
+	sb.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n", html.EscapeString(post.Title))
+	fmt.Fprintf(&sb, "<p>Published: %s<br>\nURL: <a href=\"%s\">%s</a>", html.EscapeString(post.PublishedDateTime), html.EscapeString(post.URL()), html.EscapeString(post.URL()))
+	if len(post.Tags) > 0 {
+		fmt.Fprintf(&sb, "<br>\nTags: %s", html.EscapeString(strings.Join(post.Tags, ", ")))
+	}
+	sb.WriteString("</p>\n")
+
+	for _, b := range post.contentBlocks() {
+		switch b.Type {
+		case "p":
+			fmt.Fprintf(&sb, "<p>%s</p>\n", renderHTMLText(b))
+		case "header":
+			fmt.Fprintf(&sb, "<h2>%s</h2>\n", renderHTMLText(b))
+		case "image":
+			if img, ok := post.blockImage(b); ok {
+				fmt.Fprintf(&sb, "<p><img src=\"%s\"></p>\n", html.EscapeString(link(img)))
+			}
+		case "file":
+			if f, ok := post.blockFile(b); ok {
+				fmt.Fprintf(&sb, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(link(f)), html.EscapeString(f.Name+"."+f.Extension))
+			}
+		default:
+			u := safeLinkURL(post.blockEmbedURL(b))
+			if u == "" {
+				u = post.URL()
+			}
+			fmt.Fprintf(&sb, "<p><a href=\"%s\">Embedded content</a></p>\n", html.EscapeString(u))
+		}
+	}
+
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
@@ -0,0 +1,125 @@
+package fanbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBlockText(t *testing.T) {
+	b := Block{
+		Type: "p",
+		// "😀" is 2 code units in UTF-16
+		Text:   "😀 bold link",
+		Styles: []BlockStyle{{Type: "bold", Offset: 3, Length: 4}},
+		Links:  []BlockLink{{Offset: 8, Length: 4, URL: "https://example.com"}},
+	}
+
+	assert.Equal(t, []textSegment{
+		{Text: "😀 "},
+		{Text: "bold", Bold: true},
+		{Text: " "},
+		{Text: "link", URL: "https://example.com"},
+	}, splitBlockText(b))
+}
+
+func TestRenderPost(t *testing.T) {
+	imageID, fileID := "img1", "file1"
+	post := Post{
+		ID:                "post1",
+		Title:             "Title",
+		PublishedDateTime: "2022-03-17T01:00:00+09:00",
+		CreatorID:         "creator",
+		Tags:              []string{"tag1", "tag2"},
+		Body: &PostBody{
+			Blocks: &[]Block{
+				{Type: "header", Text: "Header"},
+				{Type: "p", Text: "line1\nline2 *bold*", Styles: []BlockStyle{{Type: "bold", Offset: 12, Length: 6}}},
+				{Type: "image", ImageID: &imageID},
+				{Type: "file", FileID: &fileID},
+			},
+			ImageMap: &map[string]Image{imageID: {ID: imageID, Extension: "jpeg"}},
+			FileMap:  &map[string]File{fileID: {ID: fileID, Name: "archive", Extension: "zip"}},
+		},
+	}
+	link := func(d Downloadable) string {
+		return d.GetID() + "." + d.GetExtension()
+	}
+
+	assert.Equal(t, `# Title
+
+- Published: 2022-03-17T01:00:00+09:00
+- URL: <https://www.fanbox.cc/@creator/posts/post1>
+- Tags: tag1, tag2
+
+## Header
+
+line1  
+line2 **\*bold\***
+
+![](<img1.jpeg>)
+
+[archive.zip](<file1.zip>)
+`, renderPostMarkdown(post, link))
+
+	assert.Contains(t, renderPostHTML(post, link), `<p>line1<br>
+line2 <b>*bold*</b></p>
+<p><img src="img1.jpeg"></p>
+<p><a href="file1.zip">archive.zip</a></p>`)
+}
+
+func TestRenderPost_UnsafeLinks(t *testing.T) {
+	post := Post{
+		ID:                "post1",
+		Title:             "Title",
+		PublishedDateTime: "2022-03-17T01:00:00+09:00",
+		CreatorID:         "creator",
+		Body: &PostBody{
+			Blocks: &[]Block{
+				{Type: "p", Text: "script data ok rel", Links: []BlockLink{
+					{Offset: 0, Length: 6, URL: "javascript:alert(1)"},
+					{Offset: 7, Length: 4, URL: " data:text/html,<script>"},
+					{Offset: 12, Length: 2, URL: "https://example.com/a>b"},
+					{Offset: 15, Length: 3, URL: "other/page"},
+				}},
+			},
+		},
+	}
+	link := func(d Downloadable) string {
+		return d.GetID()
+	}
+
+	assert.Contains(t, renderPostMarkdown(post, link), "\nscript data [ok](<https://example.com/a%3Eb>) [rel](<other/page>)\n")
+	assert.Contains(t, renderPostHTML(post, link), `<p>script data <a href="https://example.com/a&gt;b">ok</a> <a href="other/page">rel</a></p>`)
+}
+
+func TestClient_renderPost_SkippedAssets(t *testing.T) {
+	imageID, fileID := "img1", "file1"
+	post := Post{
+		ID:                "post1",
+		Title:             "Title",
+		PublishedDateTime: "2022-03-17T01:00:00+09:00",
+		CreatorID:         "creator",
+		Body: &PostBody{
+			Blocks: &[]Block{
+				{Type: "image", ImageID: &imageID},
+				{Type: "file", FileID: &fileID},
+			},
+			ImageMap: &map[string]Image{imageID: {ID: imageID, Extension: "jpeg", OriginalURL: "https://downloads.fanbox.cc/images/img1.jpeg"}},
+			FileMap:  &map[string]File{fileID: {ID: fileID, Name: "archive", Extension: "zip", URL: "https://downloads.fanbox.cc/files/file1.zip"}},
+		},
+	}
+	storage := &LocalStorage{SaveDir: t.TempDir()}
+	client := &Client{RenderPosts: true, SkipImages: true, Storage: storage}
+	require.NoError(t, client.renderPost(context.Background(), post))
+
+	// named by the post ID not to collide with posts of the same title and date
+	b, err := os.ReadFile(filepath.Join(storage.SaveDir, "creator", "2022-03-16-Title-post1.index.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "![](<https://downloads.fanbox.cc/images/img1.jpeg>)\n")
+	assert.Contains(t, string(b), "[archive.zip](<2022-03-16-Title-file-0-file1.zip>)\n")
+}
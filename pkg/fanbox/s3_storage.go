@@ -0,0 +1,221 @@
+package fanbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize is the size of each part of multipart uploads.
+// Assets smaller than this are uploaded by a single request.
+const s3PartSize = 16 << 20
+
+// s3PartBufPool pools buffers of the first part, not to allocate s3PartSize for each asset.
+var s3PartBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, s3PartSize)
+		return &b
+	},
+}
+
+// S3Storage saves assets into a bucket of S3 compatible object storage, such as Amazon S3 or MinIO.
+// Object keys have the same layout as LocalStorage.
+type S3Storage struct {
+	Client    *minio.Client
+	Bucket    string
+	Prefix    string
+	DirByPost bool
+	DirByPlan bool
+	// PathTemplate overrides DirByPost and DirByPlan if it is set.
+	PathTemplate *PathTemplate
+	// OriginalFileNames is whether to name files by their uploaded names instead of IDs.
+	// Files saved by their IDs before enabling it are still detected.
+	OriginalFileNames bool
+
+	RemoveUnprintableChars bool
+}
+
+var (
+	_ Storage             = (*S3Storage)(nil)
+	_ PostDocumentStorage = (*S3Storage)(nil)
+	_ RootedStorage       = (*S3Storage)(nil)
+)
+
+// Root returns the URL of the bucket and the prefix, such as "s3://bucket/prefix".
+func (s *S3Storage) Root() string {
+	return (&url.URL{Scheme: "s3", Host: s.Bucket, Path: path.Join("/", s.Prefix)}).String()
+}
+
+// NewS3StorageFromURL creates S3Storage from the URL such as "s3://bucket/prefix".
+// The following query parameters are supported:
+//   - endpoint: endpoint of the object storage, e.g. "http://localhost:9000". Default is Amazon S3.
+//   - region: region of the bucket.
+//
+// Credentials are read from the environment variables (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, MINIO_ACCESS_KEY, ...)
+// or the AWS credentials file.
+func NewS3StorageFromURL(rawURL string) (*S3Storage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse storage URL: %w", err)
+	}
+	if u.Scheme != "s3" {
+		return nil, fmt.Errorf("unsupported storage URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("bucket is not specified in storage URL %q", rawURL)
+	}
+
+	endpoint, secure := "s3.amazonaws.com", true
+	if v := u.Query().Get("endpoint"); v != "" {
+		endpoint = v
+		if eu, err := url.Parse(v); err == nil && eu.Host != "" {
+			endpoint = eu.Host
+			secure = eu.Scheme != "http"
+		}
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+		}),
+		Secure: secure,
+		Region: u.Query().Get("region"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create S3 client: %w", err)
+	}
+
+	return &S3Storage{
+		Client: client,
+		Bucket: u.Host,
+		Prefix: strings.Trim(u.Path, "/"),
+	}, nil
+}
+
+func (s *S3Storage) Save(ctx context.Context, post Post, order int, d Downloadable, r io.Reader) error {
+	key, err := s.makeObjectKey(post, order, d)
+	if err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension("." + d.GetExtension()),
+		PartSize:    s3PartSize,
+	}
+
+	// Most assets fit in a part, upload them by a single request to avoid multipart upload round trips.
+	bufp := s3PartBufPool.Get().(*[]byte)
+	defer s3PartBufPool.Put(bufp)
+	buf := *bufp
+	// io.ReadFull is not used since it reports a reader's io.ErrUnexpectedEOF (e.g. a truncated response) as a short asset.
+	n := 0
+	for n < len(buf) && err == nil {
+		var nn int
+		nn, err = r.Read(buf[n:])
+		n += nn
+	}
+	switch {
+	case err == io.EOF:
+		_, err = s.Client.PutObject(ctx, s.Bucket, key, bytes.NewReader(buf[:n]), int64(n), opts)
+	case err == nil:
+		_, err = s.Client.PutObject(ctx, s.Bucket, key, io.MultiReader(bytes.NewReader(buf), r), -1, opts)
+	default:
+		return fmt.Errorf("read asset: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("put object (%s): %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) SavePostDocument(ctx context.Context, post Post, name, ext string, r io.Reader) error {
+	loc, err := s.PostDocumentLocation(post, name, ext)
+	if err != nil {
+		return err
+	}
+	key := path.Join(s.Prefix, loc)
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read document: %w", err)
+	}
+
+	if _, err := s.Client.PutObject(ctx, s.Bucket, key, bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension("." + ext),
+	}); err != nil {
+		return fmt.Errorf("put object (%s): %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Exist(ctx context.Context, post Post, order int, d Downloadable) (bool, error) {
+	key, err := s.makeObjectKey(post, order, d)
+	if err != nil {
+		return false, err
+	}
+	keys := []string{key}
+	legacy, err := s.layout().legacyAssetPath(post, order, d)
+	if err != nil {
+		return false, err
+	}
+	if legacy != nil {
+		keys = append(keys, path.Join(append([]string{s.Prefix}, legacy...)...))
+	}
+
+	for _, key := range keys {
+		_, err := s.Client.StatObject(ctx, s.Bucket, key, minio.StatObjectOptions{})
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				continue
+			}
+			return false, fmt.Errorf("stat object (%s): %w", key, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *S3Storage) Location(post Post, order int, d Downloadable) (string, error) {
+	p, err := s.layout().assetPath(post, order, d)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(p...), nil
+}
+
+func (s *S3Storage) PostDocumentLocation(post Post, name, ext string) (string, error) {
+	p, err := s.layout().postDocumentPath(post, name, ext)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(p...), nil
+}
+
+func (s *S3Storage) makeObjectKey(post Post, order int, d Downloadable) (string, error) {
+	loc, err := s.Location(post, order, d)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.Prefix, loc), nil
+}
+
+func (s *S3Storage) layout() layout {
+	return layout{
+		DirByPost:              s.DirByPost,
+		DirByPlan:              s.DirByPlan,
+		PathTemplate:           s.PathTemplate,
+		OriginalFileNames:      s.OriginalFileNames,
+		RemoveUnprintableChars: s.RemoveUnprintableChars,
+	}
+}
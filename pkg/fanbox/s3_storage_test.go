@@ -0,0 +1,132 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in-process S3 server which supports only PUT and HEAD of objects.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[r.URL.Path] = b
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead:
+		b, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newFakeS3Client(t *testing.T, fake *fakeS3) *minio.Client {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4("", "", ""),
+		Region: "us-east-1",
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	client := newFakeS3Client(t, fake)
+
+	s := &S3Storage{
+		Client:    client,
+		Bucket:    "bucket",
+		Prefix:    "prefix",
+		DirByPost: true,
+	}
+	post := Post{
+		Title:             "title",
+		PublishedDateTime: "2022-03-15T12:00:00+09:00",
+		CreatorID:         "creator",
+	}
+	img := Image{ID: "img1", Extension: "jpeg"}
+
+	ctx := context.Background()
+	ok, err := s.Exist(ctx, post, 0, img)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, s.Save(ctx, post, 0, img, strings.NewReader("content")))
+	assert.Equal(t, []byte("content"), fake.objects["/bucket/prefix/creator/2022-03-15-title/0-img1.jpeg"])
+
+	ok, err = s.Exist(ctx, post, 0, img)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.Equal(t, "s3://bucket/prefix", s.Root())
+}
+
+func TestS3Storage_Save_ReadError(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	s := &S3Storage{Client: newFakeS3Client(t, fake), Bucket: "bucket"}
+	post := Post{
+		Title:             "title",
+		PublishedDateTime: "2022-03-15T12:00:00+09:00",
+		CreatorID:         "creator",
+	}
+
+	for _, readErr := range []error{io.ErrUnexpectedEOF, io.ErrClosedPipe} {
+		t.Run(readErr.Error(), func(t *testing.T) {
+			// the reader fails partway, such as a truncated response
+			r := io.MultiReader(strings.NewReader("cont"), iotest.ErrReader(readErr))
+			err := s.Save(context.Background(), post, 0, Image{ID: "img1", Extension: "jpeg"}, r)
+			assert.ErrorIs(t, err, readErr)
+			assert.Empty(t, fake.objects)
+		})
+	}
+}
+
+func TestNewS3StorageFromURL(t *testing.T) {
+	s, err := NewS3StorageFromURL("s3://bucket/path/to/prefix/?endpoint=http://localhost:9000&region=ap-northeast-1")
+	require.NoError(t, err)
+	assert.Equal(t, "bucket", s.Bucket)
+	assert.Equal(t, "path/to/prefix", s.Prefix)
+	assert.Equal(t, "localhost:9000", s.Client.EndpointURL().Host)
+	assert.Equal(t, "http", s.Client.EndpointURL().Scheme)
+
+	_, err = NewS3StorageFromURL("file:///tmp")
+	assert.Error(t, err)
+}
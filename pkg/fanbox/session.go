@@ -0,0 +1,97 @@
+package fanbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/net/html"
+)
+
+// SessionUser is the user of the session, which is embedded in the metadata of www.fanbox.cc pages.
+type SessionUser struct {
+	IsLoggedIn       bool   `json:"isLoggedIn"`
+	UserID           string `json:"userId"`
+	Name             string `json:"name"`
+	IconURL          string `json:"iconUrl"`
+	ShowAdultContent bool   `json:"showAdultContent"`
+}
+
+// pageMetadata is the content of <meta name="metadata">.
+type pageMetadata struct {
+	Context struct {
+		User *SessionUser `json:"user"`
+	} `json:"context"`
+}
+
+// GetSessionUser gets the user of the session.
+// IsLoggedIn of the user is false if the session is not set, or it is expired.
+func (c *OfficialAPIClient) GetSessionUser(ctx context.Context) (*SessionUser, error) {
+	resp, err := c.RequestWithHeader(ctx, http.MethodGet, "https://www.fanbox.cc/", http.Header{"Accept": {"text/html"}})
+	if err != nil {
+		return nil, fmt.Errorf("http error: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != 200 {
+		return nil, newAPIError(resp)
+	}
+
+	content, err := findMetadata(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var meta pageMetadata
+	if err := json.Unmarshal([]byte(content), &meta); err != nil {
+		return nil, fmt.Errorf("json decoding error of the page metadata: %w", err)
+	}
+	if meta.Context.User == nil {
+		return nil, fmt.Errorf("user is not found in the page metadata")
+	}
+	return meta.Context.User, nil
+}
+
+// findMetadata returns the content of <meta name="metadata"> in the HTML.
+func findMetadata(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return "", fmt.Errorf("metadata is not found in the page")
+			}
+			return "", fmt.Errorf("parse the page: %w", z.Err())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.Data != "meta" {
+				continue
+			}
+			var name, content string
+			for _, a := range t.Attr {
+				switch a.Key {
+				case "name":
+					name = a.Val
+				case "content":
+					content = a.Val
+				}
+			}
+			if name == "metadata" {
+				return content, nil
+			}
+		}
+	}
+}
+
+// ListSupportingPlans lists plans which the user supports.
+func (c *OfficialAPIClient) ListSupportingPlans(ctx context.Context) ([]Plan, error) {
+	plans := PlanListSupportingResponse{}
+	if err := c.RequestAndUnwrapJSON(ctx, http.MethodGet, "https://api.fanbox.cc/plan.listSupporting", &plans); err != nil {
+		return nil, err
+	}
+	return plans.Body, nil
+}
@@ -0,0 +1,54 @@
+package fanbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfficialAPIClient_GetSessionUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		want    *SessionUser
+		wantErr bool
+	}{
+		{
+			name: "logged in",
+			page: `<!DOCTYPE html><html><head>
+				<meta charset="utf-8">
+				<meta name="metadata" content='{"urlContext":{"host":{}},"context":{"user":{"isLoggedIn":true,"userId":"11111","name":"user &amp; co","iconUrl":"https://pixiv.pximg.net/icon.jpeg","showAdultContent":false}}}'>
+				</head><body></body></html>`,
+			want: &SessionUser{IsLoggedIn: true, UserID: "11111", Name: "user & co", IconURL: "https://pixiv.pximg.net/icon.jpeg"},
+		},
+		{
+			name: "not logged in",
+			page: `<html><head><meta name="metadata" content='{"context":{"user":{"isLoggedIn":false,"userId":null,"name":null}}}' /></head></html>`,
+			want: &SessionUser{},
+		},
+		{
+			name:    "no metadata",
+			page:    `<html><head><meta name="description" content="FANBOX"></head></html>`,
+			wantErr: true,
+		},
+		{
+			name:    "no user",
+			page:    `<html><head><meta name="metadata" content='{"context":{}}'></head></html>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPIClient(t, fakeAPI{"/": tt.page})
+			got, err := api.GetSessionUser(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
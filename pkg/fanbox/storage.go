@@ -0,0 +1,62 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+)
+
+// Storage is the interface to save downloaded assets.
+// LocalStorage is the default implementation, and library users can provide their own implementations.
+type Storage interface {
+	// Exist reports whether the asset has already been saved.
+	Exist(ctx context.Context, post Post, order int, d Downloadable) (bool, error)
+	// Save saves the asset content read from r.
+	Save(ctx context.Context, post Post, order int, d Downloadable, r io.Reader) error
+	// Location returns the slash-separated location of the asset relative to the storage root.
+	// It fails if the path template can't be executed with the post.
+	Location(post Post, order int, d Downloadable) (string, error)
+}
+
+// RootedStorage is implemented by storages which tell the root that locations are relative to,
+// so that the download index can tell which storage saved an asset.
+type RootedStorage interface {
+	Storage
+	// Root returns the absolute directory or the URL of the storage root.
+	Root() string
+}
+
+// ResumableStorage is implemented by storages which keep partially saved assets,
+// so that interrupted downloads are resumed by HTTP Range requests.
+type ResumableStorage interface {
+	Storage
+	// OpenPartial opens the partially saved asset, or creates an empty one if it doesn't exist.
+	OpenPartial(ctx context.Context, post Post, order int, d Downloadable) (PartialAsset, error)
+}
+
+// PartialAsset is a partially saved asset.
+type PartialAsset interface {
+	// Read reads the saved content from the beginning.
+	io.Reader
+	// Write appends the content.
+	io.Writer
+	// Size returns the size of the saved content.
+	Size() int64
+	// Validator returns the ETag or Last-Modified of the response which the saved content came from.
+	Validator() string
+	// Reset discards the saved content, and sets the validator of the new content.
+	Reset(validator string) error
+	// Commit completes the asset.
+	Commit() error
+	// Close closes the asset, it is kept to be resumed unless it was committed.
+	Close() error
+}
+
+// PostDocumentStorage is implemented by storages which save documents of posts,
+// such as metadata and rendered texts.
+type PostDocumentStorage interface {
+	// SavePostDocument saves the document of the post.
+	// The document is named "[name].[ext]" in the post directory, or is named after the post otherwise.
+	SavePostDocument(ctx context.Context, post Post, name, ext string, r io.Reader) error
+	// PostDocumentLocation returns the slash-separated location of the document relative to the storage root.
+	PostDocumentLocation(post Post, name, ext string) (string, error)
+}
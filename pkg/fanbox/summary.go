@@ -0,0 +1,56 @@
+package fanbox
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// RunSummary is the summary of a run for a creator.
+type RunSummary struct {
+	CreatorID              string `json:"creatorId"`
+	PostsScanned           int64  `json:"postsScanned"`
+	RestrictedPostsSkipped int64  `json:"restrictedPostsSkipped"`
+	AssetsDownloaded       int64  `json:"assetsDownloaded"`
+	BytesDownloaded        int64  `json:"bytesDownloaded"`
+	AlreadyPresent         int64  `json:"alreadyPresent"`
+	// Errors is the number of errors skipped by SkipOnError, and of deleted posts and assets.
+	Errors int64 `json:"errors"`
+	// Error is the error which stopped the run.
+	Error string `json:"error,omitempty"`
+}
+
+// runCounters accumulates RunSummary while assets are handled concurrently.
+type runCounters struct {
+	postsScanned           atomic.Int64
+	restrictedPostsSkipped atomic.Int64
+	assetsDownloaded       atomic.Int64
+	bytesDownloaded        atomic.Int64
+	alreadyPresent         atomic.Int64
+	errors                 atomic.Int64
+}
+
+func (rc *runCounters) summary(creatorID string) *RunSummary {
+	return &RunSummary{
+		CreatorID:              creatorID,
+		PostsScanned:           rc.postsScanned.Load(),
+		RestrictedPostsSkipped: rc.restrictedPostsSkipped.Load(),
+		AssetsDownloaded:       rc.assetsDownloaded.Load(),
+		BytesDownloaded:        rc.bytesDownloaded.Load(),
+		AlreadyPresent:         rc.alreadyPresent.Load(),
+		Errors:                 rc.errors.Load(),
+	}
+}
+
+type runCountersKey struct{}
+
+func withRunCounters(ctx context.Context, rc *runCounters) context.Context {
+	return context.WithValue(ctx, runCountersKey{}, rc)
+}
+
+// countersFrom returns counters of the run, or discarded counters outside of runs such as Refetch.
+func countersFrom(ctx context.Context) *runCounters {
+	if rc, ok := ctx.Value(runCountersKey{}).(*runCounters); ok {
+		return rc
+	}
+	return &runCounters{}
+}
@@ -0,0 +1,58 @@
+package fanbox
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_RunWithSummary(t *testing.T) {
+	ctx := context.Background()
+	storage := &LocalStorage{SaveDir: t.TempDir()}
+	client := &Client{
+		CheckAllPosts: true,
+		SkipOnError:   true,
+		OfficialAPIClient: newFakeAPIClient(t, fakeAPI{
+			"/post.paginateCreator?creatorId=creator": `{"body":["https://api.fanbox.cc/post.listCreator?creatorId=creator&limit=10"]}`,
+			"/post.listCreator?creatorId=creator&limit=10": `{"body":[
+				{"id":"2","title":"restricted","publishedDatetime":"2022-03-18T01:00:00+09:00","creatorId":"creator","isRestricted":true},
+				{"id":"1","title":"images","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator"}
+			]}`,
+			"/post.info?postId=1": `{"body":{"id":"1","title":"images","type":"image","publishedDatetime":"2022-03-17T01:00:00+09:00","creatorId":"creator",
+				"body":{"images":[
+					{"id":"img1","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img1.png"},
+					{"id":"img2","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img2.png"},
+					{"id":"img3","extension":"png","originalUrl":"https://downloads.fanbox.cc/images/img3.png"}
+				]}
+			}}`,
+			"/images/img2.png": "png2",
+		}),
+		Storage: storage,
+	}
+
+	post, err := client.GetPost(ctx, "1")
+	require.NoError(t, err)
+	require.NoError(t, storage.Save(ctx, post, 0, post.ListDownloadable()[0], strings.NewReader("png1")))
+
+	s, err := client.RunWithSummary(ctx, "creator")
+	require.NoError(t, err)
+	assert.Equal(t, &RunSummary{
+		CreatorID:              "creator",
+		PostsScanned:           2,
+		RestrictedPostsSkipped: 1,
+		AssetsDownloaded:       1,
+		BytesDownloaded:        4,
+		AlreadyPresent:         1,
+		Errors:                 1, // img3 is not found
+	}, s)
+
+	// a failed run has the error
+	client.OfficialAPIClient = newFakeAPIClient(t, fakeAPI{})
+	s, err = client.RunWithSummary(ctx, "creator")
+	require.ErrorIs(t, err, ErrCreatorNotFound)
+	assert.Equal(t, int64(0), s.PostsScanned)
+	assert.NotEmpty(t, s.Error)
+}